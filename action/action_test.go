@@ -0,0 +1,408 @@
+package action
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/service"
+	"github.com/m-manu/go-find-duplicates/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// createDuplicates creates files with same contents (modified a minute apart, in the order of paths passed) and
+// returns them as a group of duplicates
+func createDuplicates(t *testing.T, contents string, paths ...string) (*entity.DigestToFiles, entity.FilePathToMeta) {
+	duplicates := entity.NewDigestToFiles()
+	allFiles := make(entity.FilePathToMeta)
+	digest := entity.FileDigest{FileExtension: ".txt", FileSize: int64(len(contents)), FileHash: "h"}
+	for i, path := range paths {
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.Nil(t, os.WriteFile(path, []byte(contents), 0o644))
+		modTime := time.Now().Add(time.Duration(i-len(paths)) * time.Minute)
+		assert.Nil(t, os.Chtimes(path, modTime, modTime))
+		allFiles[path] = entity.FileMeta{Size: int64(len(contents)), ModifiedTimestamp: modTime.Unix()}
+		duplicates.Set(digest, path)
+	}
+	return duplicates, allFiles
+}
+
+func TestChooseSurvivor(t *testing.T) {
+	dir := t.TempDir()
+	rootA, rootB := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	oldest := filepath.Join(rootB, "x", "photo.txt")
+	middle := filepath.Join(rootA, "photo.txt")
+	newest := filepath.Join(rootB, "photo-copy.txt")
+	_, allFiles := createDuplicates(t, "same", oldest, middle, newest)
+	paths := []string{newest, middle, oldest}
+	for _, path := range []string{oldest, newest} {
+		meta := allFiles[path]
+		meta.Root = 1
+		allFiles[path] = meta
+	}
+	expected := map[string]string{
+		entity.KeepOldest:       oldest,
+		entity.KeepNewest:       newest,
+		entity.KeepShortestPath: middle,
+		entity.KeepLongestPath:  newest,
+		entity.KeepFirstRoot:    middle,
+	}
+	for keep, expectedSurvivor := range expected {
+		survivor, others := ChooseSurvivor(paths, allFiles, keep)
+		assert.Equal(t, expectedSurvivor, survivor, keep)
+		assert.Equal(t, 2, len(others), keep)
+		assert.NotContains(t, others, survivor, keep)
+	}
+	// Files in reference directories are always kept:
+	for _, path := range []string{oldest, newest} {
+		meta := allFiles[path]
+		meta.IsReference = true
+		allFiles[path] = meta
+	}
+	for keep := range expected {
+		survivor, others := ChooseSurvivor(paths, allFiles, keep)
+		assert.NotEqual(t, middle, survivor, keep)
+		assert.Equal(t, []string{middle}, others, keep)
+	}
+	// Files reached through symbolic links are never acted upon:
+	for _, path := range paths {
+		meta := allFiles[path]
+		meta.IsReference = false
+		meta.ViaLink = path != oldest
+		allFiles[path] = meta
+	}
+	for keep := range expected {
+		survivor, others := ChooseSurvivor(paths, allFiles, keep)
+		assert.Equal(t, oldest, survivor, keep)
+		assert.Empty(t, others, keep)
+	}
+}
+
+func TestChooseSurvivorWithNestedReference(t *testing.T) {
+	dir := t.TempDir()
+	photos, master := filepath.Join(dir, "photos"), filepath.Join(dir, "photos", "master")
+	// The copy outside the reference directory is older, so would be kept if the master copy weren't a reference file
+	createDuplicates(t, "same", filepath.Join(photos, "a.jpg"), filepath.Join(master, "a.jpg"))
+	duplicates, _, _, allFiles, err := service.FindDuplicates([]string{photos, master}, set.NewSet(master),
+		service.ScanOptions{}, 2, nil, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, duplicates.Size())
+	for _, keep := range entity.KeepStrategies {
+		for iter := duplicates.Iterator(); iter.HasNext(); {
+			_, paths := iter.Next()
+			survivor, others := ChooseSurvivor(paths, allFiles, keep)
+			assert.Equal(t, filepath.Join(master, "a.jpg"), survivor, keep)
+			assert.Equal(t, []string{filepath.Join(photos, "a.jpg")}, others, keep)
+		}
+	}
+}
+
+func TestPerformKeepsHardLinkedFile(t *testing.T) {
+	dir := t.TempDir()
+	older, linked := filepath.Join(dir, "b", "x.bin"), filepath.Join(dir, "a", "x.bin")
+	createDuplicates(t, "some contents", older, linked)
+	if err := os.Link(linked, filepath.Join(dir, "a", "x2.bin")); err != nil {
+		t.Skipf("hard links not supported: %+v", err)
+	}
+	duplicates, _, _, allFiles, err := service.FindDuplicates([]string{dir}, set.NewSet[string](),
+		service.ScanOptions{}, 2, nil, 0)
+	assert.Nil(t, err)
+	if allFiles[linked].NumLinks == 0 {
+		t.Skip("number of hard links to a file can't be found on this platform")
+	}
+	// Deleting the older file frees space, while deleting the one with another link to it wouldn't
+	summary := Perform(duplicates, allFiles, Options{Action: entity.ActionDelete, Keep: entity.KeepOldest})
+	assert.Equal(t, 1, len(summary.Done))
+	assert.Equal(t, int64(len("some contents")), summary.ReclaimedSize)
+	assert.NoFileExists(t, older)
+	assert.FileExists(t, linked)
+	assert.FileExists(t, filepath.Join(dir, "a", "x2.bin"))
+}
+
+func TestPerformOnDuplicateWithHardLinks(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")}
+	for _, action := range []string{entity.ActionDelete, entity.ActionHardLink} {
+		duplicates, allFiles := createDuplicates(t, "some contents", paths...)
+		// Both files have other links, so removing either of them doesn't free any space
+		for i, path := range paths {
+			if err := os.Link(path, filepath.Join(dir, fmt.Sprintf("other-link-%d.txt", i))); err != nil {
+				t.Skipf("hard links not supported: %+v", err)
+			}
+		}
+		info, _ := os.Lstat(paths[0])
+		if _, ok := utils.GetNumLinks(info); !ok {
+			t.Skip("number of hard links to a file can't be found on this platform")
+		}
+		summary := Perform(duplicates, allFiles, Options{Action: action, Keep: entity.KeepOldest})
+		assert.Equal(t, 1, len(summary.Done), action)
+		assert.Equal(t, int64(0), summary.ReclaimedSize, action)
+		for i := range paths {
+			assert.Nil(t, os.Remove(filepath.Join(dir, fmt.Sprintf("other-link-%d.txt", i))))
+		}
+	}
+}
+
+func TestPerformDelete(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "1.txt"), filepath.Join(dir, "2.txt"), filepath.Join(dir, "3.txt")}
+	duplicates, allFiles := createDuplicates(t, "some contents", paths...)
+	summary := Perform(duplicates, allFiles, Options{Action: entity.ActionDelete, Keep: entity.KeepNewest})
+	assert.Equal(t, 2, len(summary.Done))
+	assert.Empty(t, summary.Failed)
+	assert.Equal(t, int64(2*len("some contents")), summary.ReclaimedSize)
+	assert.FileExists(t, paths[2])
+	assert.NoFileExists(t, paths[0])
+	assert.NoFileExists(t, paths[1])
+}
+
+func TestPerformHardLink(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "1.txt"), filepath.Join(dir, "sub", "2.txt"), filepath.Join(dir, "3.txt")}
+	duplicates, allFiles := createDuplicates(t, "some contents", paths...)
+	options := Options{Action: entity.ActionHardLink, Keep: entity.KeepOldest}
+	summary := Perform(duplicates, allFiles, options)
+	assert.Equal(t, 2, len(summary.Done))
+	assert.Empty(t, summary.Failed)
+	survivorInfo, _ := os.Stat(paths[0])
+	for _, path := range paths[1:] {
+		info, err := os.Stat(path)
+		assert.Nil(t, err)
+		assert.True(t, os.SameFile(survivorInfo, info))
+	}
+	entries, _ := os.ReadDir(dir)
+	assert.Equal(t, 3, len(entries), "no temporary files should be left behind")
+	// Files that are already linked should be left alone:
+	for _, path := range paths {
+		info, _ := os.Lstat(path)
+		allFiles[path] = entity.FileMeta{Size: info.Size(), ModifiedTimestamp: info.ModTime().Unix()}
+	}
+	summary = Perform(duplicates, allFiles, options)
+	assert.Empty(t, summary.Done)
+	assert.Equal(t, 2, len(summary.Skipped))
+}
+
+func TestPerformReflink(t *testing.T) {
+	dir := t.TempDir()
+	contents := strings.Repeat("some contents ", 1000)
+	paths := []string{filepath.Join(dir, "1.txt"), filepath.Join(dir, "2.txt")}
+	duplicates, allFiles := createDuplicates(t, contents, paths...)
+	summary := Perform(duplicates, allFiles, Options{Action: entity.ActionReflink, Keep: entity.KeepOldest})
+	// Whether this succeeds depends on the filesystem, but it should never fail outright:
+	assert.Empty(t, summary.Failed)
+	assert.Equal(t, 1, len(summary.Done)+len(summary.Skipped))
+	for _, path := range paths {
+		actual, err := os.ReadFile(path)
+		assert.Nil(t, err)
+		assert.Equal(t, contents, string(actual))
+	}
+}
+
+func TestPerformSymlink(t *testing.T) {
+	for _, isRelative := range []bool{false, true} {
+		dir := t.TempDir()
+		paths := []string{filepath.Join(dir, "a", "1.txt"), filepath.Join(dir, "b", "2.txt")}
+		duplicates, allFiles := createDuplicates(t, "some contents", paths...)
+		digest, _ := service.GetDigest(paths[0], nil)
+		duplicates = entity.NewDigestToFiles()
+		for _, path := range paths {
+			duplicates.Set(digest, path)
+		}
+		originalInfo, _ := os.Lstat(paths[1])
+		summary := Perform(duplicates, allFiles, Options{Action: entity.ActionSymlink, Keep: entity.KeepOldest,
+			RelativeLinks: isRelative})
+		assert.Equal(t, 1, len(summary.Done))
+		assert.Empty(t, summary.Failed)
+		target, err := os.Readlink(paths[1])
+		assert.Nil(t, err)
+		assert.Equal(t, !isRelative, filepath.IsAbs(target))
+		linkInfo, _ := os.Lstat(paths[1])
+		if runtime.GOOS == "linux" {
+			assert.Equal(t, originalInfo.ModTime().Unix(), linkInfo.ModTime().Unix())
+		}
+		contents, err := os.ReadFile(paths[1])
+		assert.Nil(t, err)
+		assert.Equal(t, "some contents", string(contents))
+	}
+}
+
+func TestQuarantineAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	quarantineDir := filepath.Join(dir, "quarantine")
+	paths := []string{
+		filepath.Join(dir, "photos", "1.txt"),
+		filepath.Join(dir, "backup", "a", "1.txt"),
+		filepath.Join(dir, "backup", "b", "1.txt"),
+	}
+	duplicates, allFiles := createDuplicates(t, "some contents", paths...)
+	summary := Perform(duplicates, allFiles, Options{Action: entity.ActionQuarantine, Keep: entity.KeepOldest,
+		QuarantineDir: quarantineDir, RunID: "run"})
+	assert.Equal(t, 2, len(summary.Done))
+	assert.Empty(t, summary.Failed)
+	for _, path := range paths[1:] {
+		assert.NoFileExists(t, path)
+		assert.FileExists(t, mirroredPath(quarantineDir, path))
+	}
+	manifestPath := filepath.Join(quarantineDir, "manifest_run.jsonl")
+
+	// Restore a subset, with a conflict:
+	assert.Nil(t, os.WriteFile(paths[2], []byte("new file"), 0o644))
+	restoreSummary, err := Restore(manifestPath, []string{filepath.Join(dir, "backup")})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(restoreSummary.Done))
+	assert.Equal(t, 1, len(restoreSummary.Skipped))
+	assert.FileExists(t, paths[1])
+	remaining, err := readManifest(manifestPath)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(remaining))
+	assert.Equal(t, paths[2], remaining[0].OriginalPath)
+
+	// Restore the rest, once conflict is resolved:
+	assert.Nil(t, os.Remove(paths[2]))
+	restoreSummary, err = Restore(manifestPath, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(restoreSummary.Done))
+	contents, _ := os.ReadFile(paths[2])
+	assert.Equal(t, "some contents", string(contents))
+	assert.NoFileExists(t, manifestPath)
+}
+
+func TestPerformTrash(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("trash is not supported on windows")
+	}
+	dir := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", filepath.Join(dir, "data"))
+	paths := []string{filepath.Join(dir, "1.txt"), filepath.Join(dir, "a", "1.txt"), filepath.Join(dir, "b", "1.txt")}
+	duplicates, allFiles := createDuplicates(t, "some contents", paths...)
+	summary := Perform(duplicates, allFiles, Options{Action: entity.ActionTrash, Keep: entity.KeepOldest})
+	assert.Equal(t, 2, len(summary.Done))
+	assert.Empty(t, summary.Failed)
+	trashDir := filepath.Join(dir, "data", "Trash")
+	assert.FileExists(t, filepath.Join(trashDir, "files", "1.txt"))
+	assert.FileExists(t, filepath.Join(trashDir, "files", "1.txt.2"))
+	info, err := os.ReadFile(filepath.Join(trashDir, "info", "1.txt.2.trashinfo"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(info), "[Trash Info]\nPath="+paths[2]+"\nDeletionDate=")
+}
+
+func TestPerformVerifies(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{
+		filepath.Join(dir, "1.txt"), filepath.Join(dir, "2.txt"),
+		filepath.Join(dir, "3.txt"), filepath.Join(dir, "4.txt"),
+	}
+	duplicates, allFiles := createDuplicates(t, "some contents", paths...)
+	// Same size and modification time, but different contents:
+	assert.Nil(t, os.WriteFile(paths[1], []byte("SOME CONTENTS"), 0o644))
+	modTime := time.Unix(allFiles[paths[1]].ModifiedTimestamp, 0)
+	assert.Nil(t, os.Chtimes(paths[1], modTime, modTime))
+	// Modified after scan:
+	assert.Nil(t, os.WriteFile(paths[2], []byte("some contents"), 0o644))
+	summary := Perform(duplicates, allFiles, Options{Action: entity.ActionDelete, Keep: entity.KeepOldest})
+	assert.Equal(t, 1, len(summary.Done))
+	assert.Equal(t, 2, len(summary.Unverified))
+	assert.FileExists(t, paths[1])
+	assert.FileExists(t, paths[2])
+	assert.NoFileExists(t, paths[3])
+}
+
+func TestPlanAndApply(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{
+		filepath.Join(dir, "1.txt"), filepath.Join(dir, "2.txt"),
+		filepath.Join(dir, "3.txt"), filepath.Join(dir, "tab\tand\nnewline.txt"),
+	}
+	duplicates, allFiles := createDuplicates(t, "some contents", paths...)
+	planPath := filepath.Join(dir, "plan.txt")
+	planFile, _ := os.Create(planPath)
+	assert.Nil(t, WritePlan(planFile, duplicates, allFiles, Options{Keep: entity.KeepOldest, RunID: "run"}))
+	assert.Nil(t, planFile.Close())
+	for _, actionName := range []string{entity.ActionTrash, entity.ActionQuarantine, entity.ActionSymlink} {
+		assert.NotNil(t, WritePlan(io.Discard, duplicates, allFiles, Options{Action: actionName,
+			Keep: entity.KeepOldest}), "plan shouldn't propose deletion for action '%s'", actionName)
+	}
+
+	groups, err := readPlan(planPath)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(groups))
+	assert.Equal(t, 4, len(groups[0].entries))
+	assert.Equal(t, planEntry{marker: markerKeep, path: paths[0], meta: allFiles[paths[0]]}, groups[0].entries[0])
+	assert.Equal(t, paths[3], groups[0].entries[3].path)
+
+	// Edit plan: keep one more file and link another
+	planBytes, _ := os.ReadFile(planPath)
+	plan := strings.Replace(string(planBytes), markerDelete+"\t", markerKeep+"\t", 1)
+	plan = strings.Replace(plan, markerDelete+"\t", markerLink+"\t", 1)
+	assert.Nil(t, os.WriteFile(planPath, []byte(plan), 0o644))
+
+	summary, err := Apply(planPath)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(summary.Done))
+	assert.Empty(t, summary.Failed)
+	assert.FileExists(t, paths[0])
+	assert.FileExists(t, paths[1])
+	linkedInfo, _ := os.Stat(paths[2])
+	survivorInfo, _ := os.Stat(paths[0])
+	assert.True(t, os.SameFile(survivorInfo, linkedInfo))
+	assert.NoFileExists(t, paths[3])
+}
+
+func TestWriteScript(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no POSIX shell available")
+	}
+	dir := t.TempDir()
+	paths := []string{
+		filepath.Join(dir, "1.txt"), filepath.Join(dir, "it's 2.txt"),
+		filepath.Join(dir, "$(touch pwned) 3.txt"), filepath.Join(dir, "4.txt"), filepath.Join(dir, "5.txt"),
+	}
+	duplicates, allFiles := createDuplicates(t, "some contents", paths...)
+	// Size changed since scan:
+	assert.Nil(t, os.WriteFile(paths[3], []byte("other contents"), 0o644))
+	// Same size, but contents differ (e.g. as files were matched using hashes of parts of them):
+	assert.Nil(t, os.WriteFile(paths[4], []byte("some Contents"), 0o644))
+	scriptPath := filepath.Join(dir, "script.sh")
+	scriptFile, _ := os.Create(scriptPath)
+	assert.Nil(t, WriteScript(scriptFile, duplicates, allFiles, Options{Keep: entity.KeepOldest, RunID: "run"}))
+	assert.Nil(t, scriptFile.Close())
+
+	cmd := exec.Command("sh", scriptPath)
+	cmd.Dir = dir
+	assert.Nil(t, cmd.Run())
+	assert.FileExists(t, paths[0])
+	assert.NoFileExists(t, paths[1])
+	assert.NoFileExists(t, paths[2])
+	assert.FileExists(t, paths[3])
+	assert.FileExists(t, paths[4])
+	contents, _ := os.ReadFile(paths[4])
+	assert.Equal(t, "some Contents", string(contents))
+	assert.NoFileExists(t, filepath.Join(dir, "pwned"))
+
+	cmd = exec.Command("sh", scriptPath)
+	assert.NotNil(t, cmd.Run(), "script shouldn't run a second time")
+}
+
+func TestMoveFileDoesNotOverwrite(t *testing.T) {
+	dir := t.TempDir()
+	source, destination := filepath.Join(dir, "source.txt"), filepath.Join(dir, "destination.txt")
+	assert.Nil(t, os.WriteFile(source, []byte("source"), 0644))
+	assert.Nil(t, os.WriteFile(destination, []byte("destination"), 0644))
+	assert.NotNil(t, moveFile(source, destination))
+	contents, _ := os.ReadFile(destination)
+	assert.Equal(t, "destination", string(contents))
+	assert.FileExists(t, source)
+	assert.Nil(t, os.Remove(destination))
+	assert.Nil(t, moveFile(source, destination))
+	assert.NoFileExists(t, source)
+	contents, _ = os.ReadFile(destination)
+	assert.Equal(t, "source", string(contents))
+}
@@ -0,0 +1,29 @@
+package action
+
+import (
+	"os"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/utils"
+)
+
+// deleteDuplicate deletes the duplicate
+func deleteDuplicate(_ entity.FileDigest, _ string, duplicate string, meta entity.FileMeta) (int64, error) {
+	info, statErr := os.Lstat(duplicate)
+	if statErr != nil {
+		return 0, statErr
+	}
+	if err := os.Remove(duplicate); err != nil {
+		return 0, err
+	}
+	return freedSize(info, meta), nil
+}
+
+// freedSize gets the number of bytes freed by removing the file whose metadata (as of just before removing it) is
+// provided: none, if there are other hard links to it (as it still exists through those)
+func freedSize(info os.FileInfo, meta entity.FileMeta) int64 {
+	if numLinks, ok := utils.GetNumLinks(info); ok && numLinks > 1 {
+		return 0
+	}
+	return meta.Size
+}
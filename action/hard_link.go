@@ -0,0 +1,70 @@
+package action
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/utils"
+)
+
+// hardLinkDuplicate replaces the duplicate with a hard link to the survivor. This is atomic: link is created with a
+// temporary name in the duplicate's directory and then renamed over the duplicate.
+func hardLinkDuplicate(_ entity.FileDigest, survivor string, duplicate string, meta entity.FileMeta) (int64, error) {
+	survivorInfo, sErr := os.Stat(survivor)
+	if sErr != nil {
+		return 0, sErr
+	}
+	duplicateInfo, dErr := os.Lstat(duplicate)
+	if dErr != nil {
+		return 0, dErr
+	}
+	if os.SameFile(survivorInfo, duplicateInfo) {
+		return 0, skipError{fmt.Sprintf("already a hard link to \"%s\"", survivor)}
+	}
+	survivorDevice, _, sOk := utils.GetFileID(survivorInfo)
+	duplicateDevice, _, dOk := utils.GetFileID(duplicateInfo)
+	if sOk && dOk && survivorDevice != duplicateDevice {
+		return 0, skipError{fmt.Sprintf("can't hard link across filesystems (file kept is \"%s\")", survivor)}
+	}
+	replaceErr := replaceAtomically(duplicate, func(tempPath string) error {
+		return os.Link(survivor, tempPath)
+	})
+	if replaceErr != nil {
+		return 0, replaceErr
+	}
+	return freedSize(duplicateInfo, meta), nil
+}
+
+// replaceAtomically replaces the file at path with one created by the create function. The file is created with a
+// temporary name in the same directory and then renamed over the original.
+func replaceAtomically(path string, create func(tempPath string) error) error {
+	tempPath, tErr := unusedTempPath(path)
+	if tErr != nil {
+		return tErr
+	}
+	if cErr := create(tempPath); cErr != nil {
+		_ = os.Remove(tempPath)
+		return cErr
+	}
+	if rErr := os.Rename(tempPath, path); rErr != nil {
+		_ = os.Remove(tempPath)
+		return rErr
+	}
+	return nil
+}
+
+// unusedTempPath generates a path for a temporary file in the same directory as the given path
+func unusedTempPath(path string) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	tempPath := f.Name()
+	_ = f.Close()
+	if rErr := os.Remove(tempPath); rErr != nil {
+		return "", rErr
+	}
+	return tempPath, nil
+}
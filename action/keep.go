@@ -0,0 +1,73 @@
+package action
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+)
+
+// ChooseSurvivor chooses the file to be kept among duplicates: a file in a reference directory if there's one, and
+// otherwise, as per the keep strategy (one of entity.KeepStrategies), preferring files not reached through symbolic
+// links and then files that have other hard links (since acting on those wouldn't free any space, while the content
+// would still exist twice, i.e. in the file kept and in the other links). Ties are broken by path, so that the choice
+// is deterministic. Returned others are the files to be acted upon, i.e. excluding the survivor, files in reference
+// directories and files reached through symbolic links (acting on which would affect the files they point to).
+func ChooseSurvivor(paths []string, allFiles entity.FilePathToMeta, keep string) (survivor string, others []string) {
+	sorted := slices.Clone(paths)
+	slices.SortFunc(sorted, func(a, b string) int {
+		if allFiles[a].IsReference != allFiles[b].IsReference {
+			if allFiles[a].IsReference {
+				return -1
+			}
+			return 1
+		}
+		if allFiles[a].ViaLink != allFiles[b].ViaLink {
+			if allFiles[b].ViaLink {
+				return -1
+			}
+			return 1
+		}
+		if isLinked(allFiles[a]) != isLinked(allFiles[b]) {
+			if isLinked(allFiles[a]) {
+				return -1
+			}
+			return 1
+		}
+		if c := compareForKeeping(a, b, allFiles, keep); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+	for _, path := range sorted[1:] {
+		if !allFiles[path].IsReference && !allFiles[path].ViaLink {
+			others = append(others, path)
+		}
+	}
+	return sorted[0], others
+}
+
+// isLinked checks whether the file has other hard links (found or not)
+func isLinked(meta entity.FileMeta) bool {
+	return meta.NumLinks > 1
+}
+
+// compareForKeeping returns a negative number if file a is preferred over file b for keeping, a positive number if b
+// is preferred and zero if the keep strategy has no preference
+func compareForKeeping(a, b string, allFiles entity.FilePathToMeta, keep string) int {
+	switch keep {
+	case entity.KeepOldest:
+		return cmp.Compare(allFiles[a].ModifiedTimestamp, allFiles[b].ModifiedTimestamp)
+	case entity.KeepNewest:
+		return cmp.Compare(allFiles[b].ModifiedTimestamp, allFiles[a].ModifiedTimestamp)
+	case entity.KeepShortestPath:
+		return cmp.Compare(len(a), len(b))
+	case entity.KeepLongestPath:
+		return cmp.Compare(len(b), len(a))
+	case entity.KeepFirstRoot:
+		return cmp.Compare(allFiles[a].Root, allFiles[b].Root)
+	default:
+		panic("unsupported keep strategy - bug in code")
+	}
+}
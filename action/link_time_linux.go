@@ -0,0 +1,32 @@
+package action
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// See: https://man7.org/linux/man-pages/man2/utimensat.2.html
+const (
+	atFdCwd           = -100  // AT_FDCWD
+	atSymlinkNoFollow = 0x100 // AT_SYMLINK_NOFOLLOW
+)
+
+// setLinkModTime sets access and modification times of a symbolic link itself (rather than its target)
+func setLinkModTime(path string, modTime time.Time) error {
+	pathPtr, pErr := syscall.BytePtrFromString(path)
+	if pErr != nil {
+		return pErr
+	}
+	times := [2]syscall.Timespec{
+		syscall.NsecToTimespec(modTime.UnixNano()),
+		syscall.NsecToTimespec(modTime.UnixNano()),
+	}
+	dirFd := atFdCwd
+	_, _, errno := syscall.Syscall6(syscall.SYS_UTIMENSAT, uintptr(dirFd), uintptr(unsafe.Pointer(pathPtr)),
+		uintptr(unsafe.Pointer(&times)), atSymlinkNoFollow, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package action
+
+import (
+	"time"
+)
+
+// setLinkModTime sets modification time of a symbolic link itself (not supported on this platform, so this does
+// nothing)
+func setLinkModTime(_ string, _ time.Time) error {
+	return nil
+}
@@ -0,0 +1,53 @@
+package action
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// moveFile moves a file, even across filesystems (in which case, it's copied and then removed). The destination
+// must not exist already: unlike with os.Rename, a file created there in the meantime is never overwritten, as the
+// file is moved by linking it at the destination (or by copying it to a file created exclusively) and then removing
+// the source.
+func moveFile(source string, destination string) error {
+	linkErr := os.Link(source, destination)
+	if linkErr == nil {
+		return os.Remove(source)
+	}
+	if errors.Is(linkErr, fs.ErrExist) {
+		return fmt.Errorf("\"%s\" already exists", destination)
+	}
+	// Files can't be linked across filesystems (or on filesystems that don't support hard links)
+	if copyErr := copyFile(source, destination); copyErr != nil {
+		_ = os.Remove(destination)
+		return copyErr
+	}
+	return os.Remove(source)
+}
+
+// copyFile copies contents, permissions and modification time of a regular file to a new file
+func copyFile(source string, destination string) error {
+	info, statErr := os.Stat(source)
+	if statErr != nil {
+		return statErr
+	}
+	src, sErr := os.Open(source)
+	if sErr != nil {
+		return sErr
+	}
+	defer src.Close()
+	dest, dErr := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if dErr != nil {
+		return dErr
+	}
+	_, copyErr := io.Copy(dest, src)
+	syncErr := dest.Sync()
+	closeErr := dest.Close()
+	if err := errors.Join(copyErr, syncErr, closeErr); err != nil {
+		return err
+	}
+	return os.Chtimes(destination, info.ModTime(), info.ModTime())
+}
@@ -0,0 +1,122 @@
+// Package action performs actions (such as deletion) on duplicates found, keeping exactly one file in every group of
+// duplicates
+package action
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+)
+
+// Options for performing an action on duplicates
+type Options struct {
+	Action string // one of entity.Actions
+	Keep   string // one of entity.KeepStrategies
+	// RelativeLinks determines whether symbolic links point to the file kept using a relative path (rather than
+	// an absolute one)
+	RelativeLinks bool
+	QuarantineDir string // directory to which duplicates are moved, for action entity.ActionQuarantine
+	RunID         string // identifies the run (used for naming files created by actions)
+}
+
+// Outcome is the result of performing an action on a duplicate file
+type Outcome struct {
+	Path     string
+	Survivor string
+	Err      error
+}
+
+// Summary is the result of performing an action on all duplicates
+type Summary struct {
+	Done          []Outcome
+	Skipped       []Outcome
+	Failed        []Outcome
+	Unverified    []Outcome // duplicates left untouched, as they couldn't be verified to be same as the survivor
+	ReclaimedSize int64
+}
+
+// skipError is an error due to which an action was deliberately not performed on a file
+type skipError struct {
+	reason string
+}
+
+// Error returns the reason for skipping
+func (e skipError) Error() string {
+	return e.reason
+}
+
+// operation performs an action on a duplicate of the survivor (both having the digest provided) and returns the
+// number of bytes reclaimed
+type operation func(digest entity.FileDigest, survivor string, duplicate string, meta entity.FileMeta) (
+	reclaimedSize int64, err error)
+
+// Perform performs the action on all duplicates, keeping one file (the "survivor") in every group. Before the action
+// is performed on a duplicate, it's verified to be byte-by-byte identical to the survivor, and both are verified to be
+// unchanged since they were scanned.
+func Perform(duplicates *entity.DigestToFiles, allFiles entity.FilePathToMeta, options Options) (summary Summary) {
+	op, finish := operationFor(options)
+	defer finish()
+	for iter := duplicates.Iterator(); iter.HasNext(); {
+		digest, paths := iter.Next()
+		survivor, others := ChooseSurvivor(paths, allFiles, options.Keep)
+		survivorErr := verifyUnchanged(survivor, allFiles[survivor])
+		for _, path := range others {
+			summary.performOn(op, *digest, survivor, survivorErr, path, allFiles[path])
+		}
+	}
+	return summary
+}
+
+// performOn verifies the duplicate and then performs the operation on it, recording the outcome in the summary.
+// survivorErr is the error from verifying that the survivor is unchanged.
+func (summary *Summary) performOn(op operation, digest entity.FileDigest, survivor string, survivorErr error,
+	duplicate string, meta entity.FileMeta,
+) {
+	outcome := Outcome{Path: duplicate, Survivor: survivor}
+	if survivorErr != nil {
+		outcome.Err = fmt.Errorf("file to be kept %+v", survivorErr)
+	} else {
+		outcome.Err = verifyDuplicate(survivor, duplicate, meta)
+	}
+	if outcome.Err != nil {
+		summary.Unverified = append(summary.Unverified, outcome)
+		return
+	}
+	var reclaimedSize int64
+	reclaimedSize, outcome.Err = op(digest, survivor, duplicate, meta)
+	var se skipError
+	if outcome.Err == nil {
+		summary.Done = append(summary.Done, outcome)
+		summary.ReclaimedSize += reclaimedSize
+	} else if errors.As(outcome.Err, &se) {
+		summary.Skipped = append(summary.Skipped, outcome)
+	} else {
+		summary.Failed = append(summary.Failed, outcome)
+	}
+}
+
+// operationFor gets the operation for the action in the options, along with a function to be called once the
+// operation has been performed on all duplicates
+func operationFor(options Options) (op operation, finish func()) {
+	finish = func() {}
+	switch options.Action {
+	case entity.ActionDelete:
+		return deleteDuplicate, finish
+	case entity.ActionHardLink:
+		return hardLinkDuplicate, finish
+	case entity.ActionReflink:
+		return reflinkDuplicate, finish
+	case entity.ActionSymlink:
+		return func(digest entity.FileDigest, survivor string, duplicate string, meta entity.FileMeta) (int64, error) {
+			return symlinkDuplicate(digest, survivor, duplicate, meta, options.RelativeLinks)
+		}, finish
+	case entity.ActionQuarantine:
+		q := newQuarantiner(options.QuarantineDir, options.RunID)
+		return q.quarantine, q.close
+	case entity.ActionTrash:
+		return newTrasher().trash, finish
+	default:
+		panic("unsupported action - bug in code")
+	}
+}
@@ -0,0 +1,209 @@
+package action
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+)
+
+// Markers in a plan, which determine what is done to a file
+const (
+	markerKeep   = "KEEP"
+	markerDelete = "DELETE"
+	markerLink   = "LINK"
+)
+
+const (
+	planGroupPrefix = "=="
+	planTimeFormat  = time.RFC3339
+)
+
+const planHeader = `# go-find-duplicates plan (run id %s)
+#
+# Every group of duplicates starts with a line beginning with "%s", followed by a line per file in the group:
+#     <marker> <size> <last modified> <path>
+# where <marker> is one of:
+#     %-6s = file is left as is (every group needs at least one of these)
+#     %-6s = file is deleted
+#     %-6s = file is replaced with a hard link to the first %s file of the group
+# Edit markers (or remove lines) as per your needs and then run:
+#     go-find-duplicates apply <this file>
+# Before a file is deleted or linked, it is verified to be unchanged since this plan was created, and to be identical
+# to the file kept.
+`
+
+// planGroup is a group of duplicates in a plan
+type planGroup struct {
+	entries []planEntry
+}
+
+// planEntry is a file in a plan, along with what is to be done to it
+type planEntry struct {
+	marker string
+	path   string
+	meta   entity.FileMeta
+}
+
+// PlanActions are the actions that can be proposed in a plan written by WritePlan
+var PlanActions = []string{entity.ActionNone, entity.ActionDelete, entity.ActionHardLink}
+
+// WritePlan writes a plan, listing every group of duplicates along with what is proposed to be done to every file in
+// it: the survivor (and files in reference directories or reached through symbolic links) are marked to be kept, while
+// the rest are marked to be linked (if the action in options is entity.ActionHardLink) or deleted (if it's one of
+// the other PlanActions)
+func WritePlan(w io.Writer, duplicates *entity.DigestToFiles, allFiles entity.FilePathToMeta, options Options) error {
+	if !slices.Contains(PlanActions, options.Action) {
+		return fmt.Errorf("action '%s' can't be proposed in a plan", options.Action)
+	}
+	bw := bufio.NewWriter(w)
+	_, _ = fmt.Fprintf(bw, planHeader, options.RunID, planGroupPrefix, markerKeep, markerDelete, markerLink,
+		markerKeep)
+	proposedMarker := markerDelete
+	if options.Action == entity.ActionHardLink {
+		proposedMarker = markerLink
+	}
+	groupNum := 0
+	for iter := duplicates.Iterator(); iter.HasNext(); {
+		digest, paths := iter.Next()
+		groupNum++
+		survivor, others := ChooseSurvivor(paths, allFiles, options.Keep)
+		_, _ = fmt.Fprintf(bw, "\n%s group %d: %s\n", planGroupPrefix, groupNum, digest)
+		writePlanEntry(bw, planEntry{marker: markerKeep, path: survivor, meta: allFiles[survivor]})
+		for _, path := range paths {
+			if path != survivor && (allFiles[path].IsReference || allFiles[path].ViaLink) {
+				writePlanEntry(bw, planEntry{marker: markerKeep, path: path, meta: allFiles[path]})
+			}
+		}
+		for _, path := range others {
+			writePlanEntry(bw, planEntry{marker: proposedMarker, path: path, meta: allFiles[path]})
+		}
+	}
+	return bw.Flush()
+}
+
+// writePlanEntry writes a line for the file. Paths are quoted, only if they have characters that would otherwise make
+// the plan ambiguous.
+func writePlanEntry(w io.Writer, entry planEntry) {
+	path := entry.path
+	if quoted := strconv.Quote(path); quoted != `"`+path+`"` || strings.TrimSpace(path) != path {
+		path = quoted
+	}
+	_, _ = fmt.Fprintf(w, "%-6s\t%d\t%s\t%s\n", entry.marker, entry.meta.Size,
+		time.Unix(entry.meta.ModifiedTimestamp, 0).UTC().Format(planTimeFormat), path)
+}
+
+// Apply carries out the plan (possibly edited since it was written by WritePlan). Every group is re-validated
+// against current state of files: files marked for deletion or linking are verified to be unchanged since the plan
+// was written and to be identical to the file kept.
+func Apply(planPath string) (summary Summary, err error) {
+	groups, readErr := readPlan(planPath)
+	if readErr != nil {
+		return summary, readErr
+	}
+	for _, group := range groups {
+		var survivor *planEntry
+		for i := range group.entries {
+			if group.entries[i].marker == markerKeep {
+				survivor = &group.entries[i]
+				break
+			}
+		}
+		for _, entry := range group.entries {
+			var op operation
+			switch entry.marker {
+			case markerKeep:
+				continue
+			case markerDelete:
+				op = deleteDuplicate
+			case markerLink:
+				op = hardLinkDuplicate
+			}
+			if survivor == nil {
+				summary.Skipped = append(summary.Skipped, Outcome{
+					Path: entry.path,
+					Err:  skipError{fmt.Sprintf("no file in its group is marked %s", markerKeep)},
+				})
+				continue
+			}
+			if filepath.Clean(entry.path) == filepath.Clean(survivor.path) {
+				summary.Skipped = append(summary.Skipped, Outcome{
+					Path: entry.path,
+					Err:  skipError{fmt.Sprintf("it's also marked %s", markerKeep)},
+				})
+				continue
+			}
+			summary.performOn(op, entity.FileDigest{}, survivor.path, verifyUnchanged(survivor.path, survivor.meta),
+				entry.path, entry.meta)
+		}
+	}
+	return summary, nil
+}
+
+// readPlan reads and parses a plan
+func readPlan(planPath string) ([]planGroup, error) {
+	f, openErr := os.Open(planPath)
+	if openErr != nil {
+		return nil, fmt.Errorf("couldn't open plan: %+v", openErr)
+	}
+	defer f.Close()
+	var groups []planGroup
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, planGroupPrefix) {
+			groups = append(groups, planGroup{})
+			continue
+		}
+		if len(groups) == 0 {
+			return nil, fmt.Errorf("line %d of plan is not in any group", lineNum)
+		}
+		entry, parseErr := parsePlanEntry(line)
+		if parseErr != nil {
+			return nil, fmt.Errorf("invalid line %d of plan: %+v", lineNum, parseErr)
+		}
+		groups[len(groups)-1].entries = append(groups[len(groups)-1].entries, entry)
+	}
+	if scanErr := scanner.Err(); scanErr != nil {
+		return nil, fmt.Errorf("couldn't read plan: %+v", scanErr)
+	}
+	return groups, nil
+}
+
+// parsePlanEntry parses a line written by writePlanEntry
+func parsePlanEntry(line string) (entry planEntry, err error) {
+	fields := strings.SplitN(line, "\t", 4)
+	if len(fields) != 4 {
+		return entry, fmt.Errorf("expected 4 tab-separated fields, but found %d", len(fields))
+	}
+	entry.marker = strings.ToUpper(strings.TrimSpace(fields[0]))
+	if entry.marker != markerKeep && entry.marker != markerDelete && entry.marker != markerLink {
+		return entry, fmt.Errorf("unknown marker '%s'", fields[0])
+	}
+	if entry.meta.Size, err = strconv.ParseInt(strings.TrimSpace(fields[1]), 10, 64); err != nil {
+		return entry, fmt.Errorf("invalid size: %+v", err)
+	}
+	modified, timeErr := time.Parse(planTimeFormat, strings.TrimSpace(fields[2]))
+	if timeErr != nil {
+		return entry, fmt.Errorf("invalid modification time: %+v", timeErr)
+	}
+	entry.meta.ModifiedTimestamp = modified.Unix()
+	entry.path = fields[3]
+	if strings.HasPrefix(entry.path, `"`) {
+		if entry.path, err = strconv.Unquote(entry.path); err != nil {
+			return entry, fmt.Errorf("invalid quoted path: %+v", err)
+		}
+	}
+	return entry, nil
+}
@@ -0,0 +1,206 @@
+package action
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/utils"
+)
+
+// QuarantineEntry is an entry in the manifest of a quarantine directory. It maps a file moved to the quarantine
+// directory back to its original location.
+type QuarantineEntry struct {
+	OriginalPath    string `json:"original"`
+	QuarantinedPath string `json:"quarantined"`
+	Size            int64  `json:"size"`
+	Hash            string `json:"hash"`
+}
+
+// quarantiner moves duplicates to a quarantine directory (mirroring their original directory structure), and
+// records every move in a manifest
+type quarantiner struct {
+	dir          string
+	manifestPath string
+	manifest     *os.File
+}
+
+// newQuarantiner creates a quarantiner whose manifest is named after the run
+func newQuarantiner(dir string, runID string) *quarantiner {
+	return &quarantiner{
+		dir:          dir,
+		manifestPath: filepath.Join(dir, fmt.Sprintf("manifest_%s.jsonl", runID)),
+	}
+}
+
+// quarantine moves the duplicate to the quarantine directory
+func (q *quarantiner) quarantine(digest entity.FileDigest, _ string, duplicate string, meta entity.FileMeta) (
+	int64, error,
+) {
+	if q.manifest == nil {
+		if mkErr := os.MkdirAll(q.dir, 0o755); mkErr != nil {
+			return 0, fmt.Errorf("couldn't create quarantine directory: %+v", mkErr)
+		}
+		manifest, openErr := os.OpenFile(q.manifestPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if openErr != nil {
+			return 0, fmt.Errorf("couldn't create manifest: %+v", openErr)
+		}
+		q.manifest = manifest
+	}
+	info, statErr := os.Lstat(duplicate)
+	if statErr != nil {
+		return 0, statErr
+	}
+	destination := unusedPath(mirroredPath(q.dir, duplicate))
+	if mkErr := os.MkdirAll(filepath.Dir(destination), 0o755); mkErr != nil {
+		return 0, mkErr
+	}
+	if mvErr := moveFile(duplicate, destination); mvErr != nil {
+		return 0, mvErr
+	}
+	entryJSON, _ := json.Marshal(QuarantineEntry{
+		OriginalPath:    duplicate,
+		QuarantinedPath: destination,
+		Size:            meta.Size,
+		Hash:            digest.FileHash,
+	})
+	if _, wErr := q.manifest.Write(append(entryJSON, '\n')); wErr != nil {
+		if undoErr := moveFile(destination, duplicate); undoErr != nil {
+			return 0, fmt.Errorf("couldn't record \"%s\" in manifest: %+v", destination, wErr)
+		}
+		return 0, fmt.Errorf("couldn't record in manifest (so, not quarantined): %+v", wErr)
+	}
+	return freedSize(info, meta), nil
+}
+
+// close closes the manifest
+func (q *quarantiner) close() {
+	if q.manifest != nil {
+		_ = q.manifest.Close()
+	}
+}
+
+// Restore moves files quarantined earlier back to their original locations, as recorded in the manifest. If paths
+// are provided, only files that were originally under those paths are restored. Files whose original location is
+// occupied now are skipped. The manifest is then rewritten to retain only the files that weren't restored.
+func Restore(manifestPath string, paths []string) (summary Summary, err error) {
+	entries, readErr := readManifest(manifestPath)
+	if readErr != nil {
+		return summary, readErr
+	}
+	var remaining []QuarantineEntry
+	for _, entry := range entries {
+		if !isSelected(entry.OriginalPath, paths) {
+			remaining = append(remaining, entry)
+			continue
+		}
+		outcome := Outcome{Path: entry.OriginalPath}
+		if _, statErr := os.Lstat(entry.OriginalPath); statErr == nil {
+			outcome.Err = skipError{"original location is occupied by another file now"}
+		} else if mkErr := os.MkdirAll(filepath.Dir(entry.OriginalPath), 0o755); mkErr != nil {
+			outcome.Err = mkErr
+		} else {
+			outcome.Err = moveFile(entry.QuarantinedPath, entry.OriginalPath)
+		}
+		if outcome.Err == nil {
+			summary.Done = append(summary.Done, outcome)
+			continue
+		}
+		remaining = append(remaining, entry)
+		var se skipError
+		if errors.As(outcome.Err, &se) {
+			summary.Skipped = append(summary.Skipped, outcome)
+		} else {
+			summary.Failed = append(summary.Failed, outcome)
+		}
+	}
+	return summary, writeManifest(manifestPath, remaining)
+}
+
+// isSelected checks whether the path is under any of the selected paths (when no paths are selected, every path is)
+func isSelected(path string, selected []string) bool {
+	if len(selected) == 0 {
+		return true
+	}
+	for _, s := range selected {
+		if utils.IsUnder(path, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// readManifest reads all entries from a manifest
+func readManifest(manifestPath string) ([]QuarantineEntry, error) {
+	f, openErr := os.Open(manifestPath)
+	if openErr != nil {
+		return nil, fmt.Errorf("couldn't open manifest: %+v", openErr)
+	}
+	defer f.Close()
+	var entries []QuarantineEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var entry QuarantineEntry
+		if jErr := json.Unmarshal([]byte(line), &entry); jErr != nil {
+			return nil, fmt.Errorf("invalid entry at line %d of manifest: %+v", lineNum, jErr)
+		}
+		entries = append(entries, entry)
+	}
+	if scanErr := scanner.Err(); scanErr != nil {
+		return nil, fmt.Errorf("couldn't read manifest: %+v", scanErr)
+	}
+	return entries, nil
+}
+
+// writeManifest replaces contents of the manifest with the entries provided (or removes it, if there are none)
+func writeManifest(manifestPath string, entries []QuarantineEntry) error {
+	if len(entries) == 0 {
+		if rmErr := os.Remove(manifestPath); rmErr != nil && !errors.Is(rmErr, fs.ErrNotExist) {
+			return fmt.Errorf("couldn't remove manifest: %+v", rmErr)
+		}
+		return nil
+	}
+	var sb strings.Builder
+	for _, entry := range entries {
+		entryJSON, _ := json.Marshal(entry)
+		sb.Write(entryJSON)
+		sb.WriteByte('\n')
+	}
+	return replaceAtomically(manifestPath, func(tempPath string) error {
+		return os.WriteFile(tempPath, []byte(sb.String()), 0o644)
+	})
+}
+
+// mirroredPath gets the path under the directory that mirrors the (absolute) path provided
+func mirroredPath(dir string, path string) string {
+	volume := filepath.VolumeName(path)
+	volumeDir := strings.Map(func(r rune) rune {
+		if r == ':' || r == '\\' || r == '/' {
+			return -1
+		}
+		return r
+	}, volume)
+	return filepath.Join(dir, volumeDir, path[len(volume):])
+}
+
+// unusedPath gets the path provided, if nothing exists there, or else, that with a numeric suffix
+func unusedPath(path string) string {
+	candidate := path
+	for i := 1; ; i++ {
+		if _, statErr := os.Lstat(candidate); errors.Is(statErr, fs.ErrNotExist) {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s.%d", path, i)
+	}
+}
@@ -0,0 +1,87 @@
+package action
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"github.com/m-manu/go-find-duplicates/bytesutil"
+	"github.com/m-manu/go-find-duplicates/entity"
+)
+
+// See: https://man7.org/linux/man-pages/man2/ioctl_fideduperange.2.html
+const (
+	ioctlFileDedupeRange   = 0xC0189436 // FIDEDUPERANGE
+	fileDedupeRangeDiffers = 1          // FILE_DEDUPE_RANGE_DIFFERS
+	dedupeChunkSize        = 16 * bytesutil.MEBI
+)
+
+// fileDedupeRange is struct file_dedupe_range (with a single struct file_dedupe_range_info) of linux/fs.h
+type fileDedupeRange struct {
+	srcOffset    uint64
+	srcLength    uint64
+	destCount    uint16
+	reserved1    uint16
+	reserved2    uint32
+	destFd       int64
+	destOffset   uint64
+	bytesDeduped uint64
+	status       int32
+	infoReserved uint32
+}
+
+// reflinkDuplicate makes the duplicate share its storage (extents) with the survivor, while it continues to be an
+// independent file. This uses the FIDEDUPERANGE ioctl (rather than FICLONE), as with it, the kernel itself verifies
+// that contents are same, and the duplicate retains its own metadata.
+func reflinkDuplicate(_ entity.FileDigest, survivor string, duplicate string, meta entity.FileMeta) (int64, error) {
+	src, sErr := os.Open(survivor)
+	if sErr != nil {
+		return 0, sErr
+	}
+	defer src.Close()
+	dest, dErr := os.OpenFile(duplicate, os.O_RDWR, 0)
+	if dErr != nil {
+		return 0, dErr
+	}
+	defer dest.Close()
+	var deduped int64
+	for deduped < meta.Size {
+		arg := fileDedupeRange{
+			srcOffset:  uint64(deduped),
+			srcLength:  uint64(min(meta.Size-deduped, dedupeChunkSize)),
+			destCount:  1,
+			destFd:     int64(dest.Fd()),
+			destOffset: uint64(deduped),
+		}
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, src.Fd(), ioctlFileDedupeRange,
+			uintptr(unsafe.Pointer(&arg)))
+		if errno == 0 && arg.status < 0 {
+			errno = syscall.Errno(-arg.status)
+		}
+		if errno != 0 {
+			return deduped, reflinkError(errno, survivor)
+		}
+		if arg.status == fileDedupeRangeDiffers {
+			return deduped, fmt.Errorf("contents differ from \"%s\"", survivor)
+		}
+		if arg.bytesDeduped == 0 {
+			return deduped, fmt.Errorf("filesystem made no progress sharing storage with \"%s\"", survivor)
+		}
+		deduped += int64(arg.bytesDeduped)
+	}
+	return deduped, nil
+}
+
+// reflinkError converts an error from FIDEDUPERANGE ioctl to a (more meaningful) error
+func reflinkError(errno syscall.Errno, survivor string) error {
+	switch {
+	case errors.Is(errno, syscall.EXDEV):
+		return skipError{fmt.Sprintf("can't share storage across filesystems (file kept is \"%s\")", survivor)}
+	case errors.Is(errno, syscall.EOPNOTSUPP), errors.Is(errno, syscall.ENOTTY), errors.Is(errno, syscall.EINVAL):
+		return skipError{fmt.Sprintf("filesystem doesn't support sharing storage between files: %v", errno)}
+	default:
+		return errno
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package action
+
+import (
+	"github.com/m-manu/go-find-duplicates/entity"
+)
+
+// reflinkDuplicate makes the duplicate share its storage with the survivor (not supported on this platform)
+func reflinkDuplicate(_ entity.FileDigest, _ string, _ string, _ entity.FileMeta) (int64, error) {
+	return 0, skipError{"sharing storage between files is supported only on Linux"}
+}
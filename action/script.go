@@ -0,0 +1,118 @@
+package action
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+)
+
+// ScriptActions are the actions that can be performed by a script written by WriteScript
+var ScriptActions = []string{entity.ActionNone, entity.ActionDelete, entity.ActionHardLink, entity.ActionSymlink}
+
+const scriptHeader = `#!/bin/sh
+# go-find-duplicates script (run id %s)
+#
+# Review this script and then run it using:
+#     sh <this file>
+# Before a file is acted upon, the file and the file kept in its group are checked to exist with expected sizes and
+# to have identical contents.
+# This script refuses to run more than once.
+
+set -u
+
+done_marker="$0.done"
+if [ -e "$done_marker" ]; then
+	echo "error: this script has been run already (remove \"$done_marker\" to run it again)" >&2
+	exit 1
+fi
+: > "$done_marker" || exit 1
+
+failures=0
+
+# intact <path> <size>: checks whether a regular file exists at the path with the given size
+intact() {
+	if [ -f "$1" ] && [ ! -h "$1" ] && [ "$(wc -c < "$1" | tr -d ' ')" = "$2" ]; then
+		return 0
+	fi
+	echo "skipping: \"$1\" is missing or its size has changed" >&2
+	return 1
+}
+
+# same <path> <other-path>: checks whether the files have identical contents, byte-by-byte
+same() {
+	if cmp -s -- "$1" "$2"; then
+		return 0
+	fi
+	echo "skipping: contents of \"$2\" differ from those of \"$1\" (or couldn't be compared)" >&2
+	return 1
+}
+
+# act <command...>: runs the command, counting failures
+act() {
+	if "$@"; then
+		return 0
+	fi
+	failures=$((failures + 1))
+	return 1
+}
+`
+
+const scriptFooter = `
+echo "Done ($failures failures)."
+[ "$failures" -eq 0 ]
+`
+
+// WriteScript writes a POSIX shell script which, when run, performs the action in options (one of ScriptActions,
+// where entity.ActionNone means deletion) on duplicates, keeping one file in every group. As with Perform, every
+// duplicate is compared byte-by-byte with the file kept before it's acted upon.
+func WriteScript(w io.Writer, duplicates *entity.DigestToFiles, allFiles entity.FilePathToMeta,
+	options Options) error {
+	bw := bufio.NewWriter(w)
+	_, _ = fmt.Fprintf(bw, scriptHeader, options.RunID)
+	groupNum := 0
+	for iter := duplicates.Iterator(); iter.HasNext(); {
+		digest, paths := iter.Next()
+		groupNum++
+		survivor, others := ChooseSurvivor(paths, allFiles, options.Keep)
+		_, _ = fmt.Fprintf(bw, "\n# Group %d: %s (keeping %q)\n", groupNum, digest, survivor)
+		for _, path := range others {
+			_, _ = fmt.Fprintf(bw, "intact %s %d && intact %s %d && same %s %s && %s\n",
+				shellQuote(survivor), allFiles[survivor].Size, shellQuote(path), allFiles[path].Size,
+				shellQuote(survivor), shellQuote(path), scriptCommand(options, survivor, path))
+		}
+	}
+	_, _ = bw.WriteString(scriptFooter)
+	return bw.Flush()
+}
+
+// scriptCommand gets the shell command that performs the action in options on a duplicate
+func scriptCommand(options Options, survivor string, duplicate string) string {
+	tempPath := shellQuote(duplicate + ".go-find-duplicates.tmp")
+	switch options.Action {
+	case entity.ActionNone, entity.ActionDelete:
+		return fmt.Sprintf("act rm -f -- %s", shellQuote(duplicate))
+	case entity.ActionHardLink:
+		return fmt.Sprintf("act ln -- %s %s && act mv -f -- %s %s",
+			shellQuote(survivor), tempPath, tempPath, shellQuote(duplicate))
+	case entity.ActionSymlink:
+		target := survivor
+		if options.RelativeLinks {
+			if rel, err := filepath.Rel(filepath.Dir(duplicate), survivor); err == nil {
+				target = rel
+			}
+		}
+		return fmt.Sprintf("act ln -s -- %s %s && act mv -f -- %s %s",
+			shellQuote(target), tempPath, tempPath, shellQuote(duplicate))
+	default:
+		panic("unsupported action for script - bug in code")
+	}
+}
+
+// shellQuote quotes a string for POSIX shell (using single quotes, within which no character is special)
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,53 @@
+package action
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/service"
+)
+
+// symlinkDuplicate replaces the duplicate with a symbolic link to the survivor, retaining the duplicate's
+// modification time (where the platform allows it). This is atomic, just like hardLinkDuplicate. Once replaced,
+// the link is verified to resolve to a file with the expected digest.
+func symlinkDuplicate(digest entity.FileDigest, survivor string, duplicate string, meta entity.FileMeta,
+	isRelative bool,
+) (int64, error) {
+	duplicateInfo, dErr := os.Lstat(duplicate)
+	if dErr != nil {
+		return 0, dErr
+	}
+	target := survivor
+	if isRelative {
+		rel, relErr := filepath.Rel(filepath.Dir(duplicate), survivor)
+		if relErr != nil {
+			return 0, relErr
+		}
+		target = rel
+	}
+	replaceErr := replaceAtomically(duplicate, func(tempPath string) error {
+		if lErr := os.Symlink(target, tempPath); lErr != nil {
+			return lErr
+		}
+		return setLinkModTime(tempPath, duplicateInfo.ModTime())
+	})
+	if replaceErr != nil {
+		return 0, replaceErr
+	}
+	freed := freedSize(duplicateInfo, meta)
+	resolved, resolveErr := filepath.EvalSymlinks(duplicate)
+	if resolveErr != nil {
+		return freed, fmt.Errorf("replaced with a link that doesn't resolve: %+v", resolveErr)
+	}
+	resolvedDigest, digestErr := service.GetDigest(resolved, nil)
+	if digestErr != nil {
+		return freed, fmt.Errorf("replaced with a link to \"%s\" that couldn't be verified: %+v", resolved,
+			digestErr)
+	}
+	if resolvedDigest != digest {
+		return freed, fmt.Errorf("replaced with a link to \"%s\" whose contents don't match", resolved)
+	}
+	return freed, nil
+}
@@ -0,0 +1,175 @@
+package action
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/utils"
+)
+
+// trasher moves duplicates to trash, as per the freedesktop.org Trash specification. Files on the same filesystem as
+// the home trash go there, while files on other filesystems go to a trash directory at top of their filesystem.
+//
+// See: https://specifications.freedesktop.org/trash-spec/latest/
+type trasher struct {
+	trashDirs map[uint64]trashDir
+}
+
+// trashDir is a trash directory, along with the directory relative to which paths in it are recorded (which is
+// empty, if paths are recorded as absolute paths)
+type trashDir struct {
+	path   string
+	topDir string
+}
+
+// newTrasher creates a trasher
+func newTrasher() *trasher {
+	return &trasher{trashDirs: make(map[uint64]trashDir)}
+}
+
+// trash moves the duplicate to trash
+func (t *trasher) trash(_ entity.FileDigest, _ string, duplicate string, meta entity.FileMeta) (int64, error) {
+	info, statErr := os.Lstat(duplicate)
+	if statErr != nil {
+		return 0, statErr
+	}
+	device, _, ok := utils.GetFileID(info)
+	if !ok || os.Getuid() < 0 {
+		return 0, skipError{"moving to trash is not supported on this platform"}
+	}
+	dir, dirErr := t.trashDirFor(duplicate, device)
+	if dirErr != nil {
+		return 0, dirErr
+	}
+	recordedPath := duplicate
+	if dir.topDir != "" {
+		if rel, relErr := filepath.Rel(dir.topDir, duplicate); relErr == nil {
+			recordedPath = rel
+		}
+	}
+	infoPath, name, infoErr := createTrashInfo(dir.path, filepath.Base(duplicate), recordedPath)
+	if infoErr != nil {
+		return 0, infoErr
+	}
+	if mvErr := os.Rename(duplicate, filepath.Join(dir.path, "files", name)); mvErr != nil {
+		_ = os.Remove(infoPath)
+		return 0, mvErr
+	}
+	return freedSize(info, meta), nil
+}
+
+// trashDirFor finds (and creates, if needed) the trash directory for a file on the given device
+func (t *trasher) trashDirFor(path string, device uint64) (trashDir, error) {
+	if dir, exists := t.trashDirs[device]; exists {
+		return dir, nil
+	}
+	dir, err := homeTrashDir()
+	if err != nil {
+		return trashDir{}, err
+	}
+	if homeDevice, dErr := deviceOf(dir.path); dErr != nil || homeDevice != device {
+		topDir := mountPointOf(filepath.Dir(path), device)
+		dir, err = topDirTrashDir(topDir)
+		if err != nil {
+			return trashDir{}, err
+		}
+	}
+	t.trashDirs[device] = dir
+	return dir, nil
+}
+
+// homeTrashDir creates (if needed) and gets the home trash directory
+func homeTrashDir() (trashDir, error) {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, homeErr := os.UserHomeDir()
+		if homeErr != nil {
+			return trashDir{}, fmt.Errorf("couldn't locate home trash: %+v", homeErr)
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	dir := trashDir{path: filepath.Join(dataHome, "Trash")}
+	return dir, createTrashSubDirs(dir.path)
+}
+
+// topDirTrashDir creates (if needed) and gets the trash directory at top of a filesystem: $topdir/.Trash/$uid if
+// the administrator has set up $topdir/.Trash, or else, $topdir/.Trash-$uid
+func topDirTrashDir(topDir string) (trashDir, error) {
+	uid := strconv.Itoa(os.Getuid())
+	sharedInfo, sharedErr := os.Lstat(filepath.Join(topDir, ".Trash"))
+	if sharedErr == nil && sharedInfo.IsDir() && sharedInfo.Mode()&os.ModeSticky != 0 {
+		dir := trashDir{path: filepath.Join(topDir, ".Trash", uid), topDir: topDir}
+		if createTrashSubDirs(dir.path) == nil {
+			return dir, nil
+		}
+	}
+	dir := trashDir{path: filepath.Join(topDir, ".Trash-"+uid), topDir: topDir}
+	return dir, createTrashSubDirs(dir.path)
+}
+
+// createTrashSubDirs creates the directories within a trash directory
+func createTrashSubDirs(dir string) error {
+	for _, sub := range []string{"files", "info"} {
+		if mkErr := os.MkdirAll(filepath.Join(dir, sub), 0o700); mkErr != nil {
+			return fmt.Errorf("couldn't create trash directory: %+v", mkErr)
+		}
+	}
+	return nil
+}
+
+// createTrashInfo creates the .trashinfo file for a file being moved to trash, under a name not already in use
+func createTrashInfo(dir string, baseName string, recordedPath string) (infoPath string, name string, err error) {
+	contents := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: recordedPath}).EscapedPath(), time.Now().Format("2006-01-02T15:04:05"))
+	name = baseName
+	for i := 2; ; i++ {
+		infoPath = filepath.Join(dir, "info", name+".trashinfo")
+		f, createErr := os.OpenFile(infoPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if createErr == nil {
+			_, wErr := f.WriteString(contents)
+			cErr := f.Close()
+			if err = errors.Join(wErr, cErr); err != nil {
+				_ = os.Remove(infoPath)
+				return "", "", err
+			}
+			if _, statErr := os.Lstat(filepath.Join(dir, "files", name)); errors.Is(statErr, fs.ErrNotExist) {
+				return infoPath, name, nil
+			}
+			_ = os.Remove(infoPath)
+		} else if !errors.Is(createErr, fs.ErrExist) {
+			return "", "", fmt.Errorf("couldn't create trash info: %+v", createErr)
+		}
+		name = fmt.Sprintf("%s.%d", baseName, i)
+	}
+}
+
+// deviceOf gets the device of a file
+func deviceOf(path string) (uint64, error) {
+	info, statErr := os.Stat(path)
+	if statErr != nil {
+		return 0, statErr
+	}
+	device, _, _ := utils.GetFileID(info)
+	return device, nil
+}
+
+// mountPointOf finds the top-most ancestor of the directory that's on the same device
+func mountPointOf(dir string, device uint64) string {
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		if parentDevice, err := deviceOf(parent); err != nil || parentDevice != device {
+			return dir
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,89 @@
+package action
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/m-manu/go-find-duplicates/bytesutil"
+	"github.com/m-manu/go-find-duplicates/entity"
+)
+
+const verificationChunkSize = 64 * bytesutil.KIBI
+
+// verifyDuplicate verifies that the duplicate is unchanged since it was scanned and that its contents are identical
+// to those of the survivor
+func verifyDuplicate(survivor string, duplicate string, meta entity.FileMeta) error {
+	if err := verifyUnchanged(duplicate, meta); err != nil {
+		return err
+	}
+	survivorInfo, sErr := os.Stat(survivor)
+	duplicateInfo, dErr := os.Stat(duplicate)
+	if sErr == nil && dErr == nil && os.SameFile(survivorInfo, duplicateInfo) {
+		return nil
+	}
+	same, cmpErr := haveSameContents(survivor, duplicate)
+	if cmpErr != nil {
+		return fmt.Errorf("couldn't be compared with \"%s\": %+v", survivor, cmpErr)
+	}
+	if !same {
+		return fmt.Errorf("contents differ from those of \"%s\"", survivor)
+	}
+	return nil
+}
+
+// verifyUnchanged verifies that size and modification time of the file are same as when it was scanned (through the
+// symbolic link, if it was reached through one)
+func verifyUnchanged(path string, meta entity.FileMeta) error {
+	stat := os.Lstat
+	if meta.ViaLink {
+		stat = os.Stat
+	}
+	info, statErr := stat(path)
+	if statErr != nil {
+		return fmt.Errorf("is not accessible: %+v", statErr)
+	}
+	if !info.Mode().IsRegular() {
+		return errors.New("is not a regular file anymore")
+	}
+	if info.Size() != meta.Size || info.ModTime().Unix() != meta.ModifiedTimestamp {
+		return errors.New("has changed since it was scanned")
+	}
+	return nil
+}
+
+// haveSameContents compares contents of two files, byte-by-byte
+func haveSameContents(pathA string, pathB string) (bool, error) {
+	fileA, aErr := os.Open(pathA)
+	if aErr != nil {
+		return false, aErr
+	}
+	defer fileA.Close()
+	fileB, bErr := os.Open(pathB)
+	if bErr != nil {
+		return false, bErr
+	}
+	defer fileB.Close()
+	chunkA := make([]byte, verificationChunkSize)
+	chunkB := make([]byte, verificationChunkSize)
+	for {
+		nA, rErrA := io.ReadFull(fileA, chunkA)
+		nB, rErrB := io.ReadFull(fileB, chunkB)
+		if !bytes.Equal(chunkA[:nA], chunkB[:nB]) {
+			return false, nil
+		}
+		endA := rErrA == io.EOF || errors.Is(rErrA, io.ErrUnexpectedEOF)
+		endB := rErrB == io.EOF || errors.Is(rErrB, io.ErrUnexpectedEOF)
+		if rErrA != nil && !endA {
+			return false, rErrA
+		}
+		if rErrB != nil && !endB {
+			return false, rErrB
+		}
+		if endA || endB {
+			return endA == endB, nil
+		}
+	}
+}
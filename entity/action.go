@@ -0,0 +1,40 @@
+package entity
+
+// Different actions that can be performed on duplicates
+const (
+	ActionNone       = ""
+	ActionDelete     = "delete"
+	ActionHardLink   = "hardlink"
+	ActionReflink    = "reflink"
+	ActionSymlink    = "symlink"
+	ActionQuarantine = "quarantine"
+	ActionTrash      = "trash"
+)
+
+// Actions and their brief descriptions
+var Actions = map[string]string{
+	ActionDelete:     "deletes duplicates, keeping just one file per group",
+	ActionHardLink:   "replaces duplicates with hard links to the file kept (when on the same filesystem)",
+	ActionReflink:    "makes duplicates share storage with the file kept, while staying independent files (Linux only)",
+	ActionSymlink:    "replaces duplicates with symbolic links to the file kept",
+	ActionQuarantine: "moves duplicates to a directory (see --quarantine-dir), so that they can be restored later",
+	ActionTrash:      "moves duplicates to trash of your desktop (as per freedesktop.org specification)",
+}
+
+// Different strategies for choosing the file to be kept among duplicates
+const (
+	KeepOldest       = "oldest"
+	KeepNewest       = "newest"
+	KeepShortestPath = "shortest-path"
+	KeepLongestPath  = "longest-path"
+	KeepFirstRoot    = "first-root"
+)
+
+// KeepStrategies and their brief descriptions
+var KeepStrategies = map[string]string{
+	KeepOldest:       "keeps the file modified earliest",
+	KeepNewest:       "keeps the file modified latest",
+	KeepShortestPath: "keeps the file with shortest path",
+	KeepLongestPath:  "keeps the file with longest path",
+	KeepFirstRoot:    "keeps the file from the input directory that's passed first",
+}
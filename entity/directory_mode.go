@@ -0,0 +1,14 @@
+package entity
+
+// Different modes of finding duplicate directories
+const (
+	DirectoryModeNone     = ""
+	DirectoryModeTree     = "tree"
+	DirectoryModeContents = "contents"
+)
+
+// DirectoryModes and their brief descriptions
+var DirectoryModes = map[string]string{
+	DirectoryModeTree:     "directories whose files and sub-directories have same names and contents, at every level",
+	DirectoryModeContents: "directories that contain files with same contents, regardless of their names and layout",
+}
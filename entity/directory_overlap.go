@@ -0,0 +1,20 @@
+package entity
+
+// DirectoryOverlap is a pair of directories that have files with same contents
+type DirectoryOverlap struct {
+	Dir             string `json:"dir"`
+	OtherDir        string `json:"otherDir"`
+	SharedSize      int64  `json:"sharedSize"`      // total size of contents found in both directories
+	UniqueSize      int64  `json:"uniqueSize"`      // total size of contents found only in Dir
+	OtherUniqueSize int64  `json:"otherUniqueSize"` // total size of contents found only in OtherDir
+	IsSubset        bool   `json:"isSubset"`        // whether all contents of Dir are found in OtherDir
+}
+
+// OverlapPercent gets the percentage of contents of both directories together that's found in both
+func (o DirectoryOverlap) OverlapPercent() float64 {
+	total := o.SharedSize + o.UniqueSize + o.OtherUniqueSize
+	if total == 0 {
+		return 0
+	}
+	return float64(o.SharedSize) * 100 / float64(total)
+}
@@ -10,9 +10,13 @@ type FileDigest struct {
 	FileExtension string `json:"ext"`
 	FileSize      int64  `json:"size"`
 	FileHash      string `json:"hash"`
+	IsDirectory   bool   `json:"dir,omitempty"` // whether this is the digest of a directory (which has no extension)
 }
 
 // String returns a string representation of FileDigest
 func (f FileDigest) String() string {
+	if f.IsDirectory {
+		return fmt.Sprintf("dir %v (%v)", f.FileHash, bytesutil.BinaryFormat(f.FileSize))
+	}
 	return fmt.Sprintf("%v/%v/%v", f.FileExtension, f.FileHash, bytesutil.BinaryFormat(f.FileSize))
 }
@@ -5,10 +5,16 @@ import (
 	"time"
 )
 
-// FileMeta is a combination of file size and its modification timestamp
+// FileMeta is a combination of file size and its modification timestamp, along with where the file was found
 type FileMeta struct {
 	Size              int64
 	ModifiedTimestamp int64
+	Root              int    // index of the input directory under which the file was found
+	IsReference       bool   // whether that input directory is a reference directory, files in which are never acted upon
+	Device            uint64 // device on which the file is (0 if not known)
+	Inode             uint64 // inode of the file, which is shared by all hard links to it (0 if not known)
+	NumLinks          uint64 // number of hard links to the file, including ones not found (0 if not known)
+	ViaLink           bool   // whether the file was reached through a symbolic link (such files are never acted upon)
 }
 
 // String returns a string representation of FileMeta
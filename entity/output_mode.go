@@ -6,6 +6,8 @@ const (
 	OutputModeCsvFile  = "csv"
 	OutputModeStdOut   = "print"
 	OutputModeJSON     = "json"
+	OutputModePlan     = "plan"
+	OutputModeScript   = "script"
 )
 
 // OutputModes and their brief descriptions
@@ -14,4 +16,6 @@ var OutputModes = map[string]string{
 	OutputModeTextFile: "creates a text file in the output directory with basic information",
 	OutputModeCsvFile:  "creates a csv file in the output directory with detailed information",
 	OutputModeJSON:     "creates a JSON file in the output directory with basic information",
+	OutputModePlan:     "creates an editable plan file in the output directory, to be carried out later using 'apply'",
+	OutputModeScript:   "creates a shell script in the output directory that performs the action (or deletion) when run",
 }
@@ -0,0 +1,163 @@
+// Package ignore matches paths against patterns in the format of .gitignore files
+package ignore
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Matcher matches paths against a list of patterns. When multiple patterns match a path, the last one wins.
+// A nil Matcher matches nothing.
+type Matcher struct {
+	patterns []pattern
+}
+
+// pattern is a parsed line of a .gitignore-style file
+type pattern struct {
+	segments   []string // glob of every path segment, where "**" matches any number of segments
+	isNegated  bool     // pattern starts with "!", i.e. matching paths are re-included
+	isDirOnly  bool     // pattern ends with "/", i.e. it matches directories only
+	isAnchored bool     // pattern has a "/" (other than at its end), i.e. it's matched against entire relative path
+}
+
+// Parse parses patterns in .gitignore format, one per line:
+// blank lines and lines starting with "#" are ignored;
+// "*" matches anything except "/", "?" matches any one character except "/" and "[...]" matches a range of characters;
+// "**/" at the start, "/**" at the end and "/**/" in the middle of a pattern match any number of directories;
+// a pattern that has a "/" at its start or middle is matched against the path relative to the root, while any other
+// pattern is matched against the name of a file or directory at any level;
+// a pattern ending with "/" matches directories only;
+// a pattern starting with "!" re-includes paths excluded by earlier patterns;
+// "\" escapes the character following it (e.g. "\#" or "\!" at the start).
+// Unlike in .gitignore files, leading whitespace is ignored too.
+func Parse(contents string) (*Matcher, error) {
+	m := &Matcher{}
+	for i, line := range strings.Split(strings.ReplaceAll(contents, "\r\n", "\n"), "\n") {
+		p, isPattern, err := parsePattern(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern on line %d: %+v", i+1, err)
+		}
+		if isPattern {
+			m.patterns = append(m.patterns, p)
+		}
+	}
+	return m, nil
+}
+
+// MustParse is like Parse, but panics on invalid patterns (meant for patterns embedded in code)
+func MustParse(contents string) *Matcher {
+	m, err := Parse(contents)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// parsePattern parses a line of a .gitignore-style file
+func parsePattern(line string) (p pattern, isPattern bool, err error) {
+	line = strings.TrimLeft(line, " \t")
+	line = trimTrailingSpaces(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return p, false, nil
+	}
+	if strings.HasPrefix(line, "!") {
+		p.isNegated = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.isDirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return p, false, nil
+	}
+	p.isAnchored = strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	for _, segment := range strings.Split(line, "/") {
+		if segment == "" {
+			continue
+		}
+		if _, mErr := path.Match(segment, ""); mErr != nil {
+			return p, false, fmt.Errorf("'%s': %+v", segment, mErr)
+		}
+		p.segments = append(p.segments, segment)
+	}
+	return p, len(p.segments) > 0, nil
+}
+
+// trimTrailingSpaces removes trailing spaces, unless they're escaped with a "\"
+func trimTrailingSpaces(line string) string {
+	trimmed := strings.TrimRight(line, " \t")
+	if strings.HasSuffix(trimmed, `\`) && len(trimmed) < len(line) {
+		return trimmed + line[len(trimmed):len(trimmed)+1]
+	}
+	return trimmed
+}
+
+// Match checks whether the path (relative to the root of the patterns, and separated by "/") is excluded.
+// Paths under an excluded directory aren't matched by this, so callers are expected to skip such directories
+// entirely.
+func (m *Matcher) Match(relPath string, isDir bool) (isExcluded bool) {
+	isExcluded, _ = m.MatchResult(relPath, isDir)
+	return isExcluded
+}
+
+// MatchResult is like Match, but also tells whether any pattern matched the path at all (so that the result can be
+// combined with that of other matchers, such as those of parent directories)
+func (m *Matcher) MatchResult(relPath string, isDir bool) (isExcluded bool, isMatched bool) {
+	if m == nil {
+		return false, false
+	}
+	relPath = strings.Trim(relPath, "/")
+	segments := strings.Split(relPath, "/")
+	for _, p := range m.patterns {
+		if p.matches(segments, isDir) {
+			isExcluded, isMatched = !p.isNegated, true
+		}
+	}
+	return isExcluded, isMatched
+}
+
+// IsEmpty checks whether there are no patterns
+func (m *Matcher) IsEmpty() bool {
+	return m == nil || len(m.patterns) == 0
+}
+
+// matches checks whether the pattern matches the path (split into segments)
+func (p pattern) matches(segments []string, isDir bool) bool {
+	if p.isDirOnly && !isDir {
+		return false
+	}
+	if !p.isAnchored {
+		return matchSegments(p.segments, segments[len(segments)-1:])
+	}
+	return matchSegments(p.segments, segments)
+}
+
+// matchSegments checks whether the glob segments match the path segments
+func matchSegments(globs []string, segments []string) bool {
+	for len(globs) > 0 {
+		if globs[0] == "**" {
+			if len(globs) == 1 { // a trailing "/**" matches everything inside, but not the directory itself
+				return len(segments) > 0
+			}
+			for skip := 0; skip <= len(segments); skip++ {
+				if matchSegments(globs[1:], segments[skip:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(globs[0], segments[0]); !matched {
+			return false
+		}
+		globs, segments = globs[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
@@ -0,0 +1,72 @@
+package ignore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const patterns = `
+# comment
+.DS_Store
+  Thumbs.db  
+*.tmp
+!keep.tmp
+/projects/*/build/
+**/cache/*.log
+logs/
+docs/**
+a/**/z
+\#hash
+\!bang
+trailing\ 
+`
+
+func TestMatch(t *testing.T) {
+	m, err := Parse(patterns)
+	assert.Nil(t, err)
+	for _, c := range []struct {
+		path       string
+		isDir      bool
+		isExcluded bool
+	}{
+		{".DS_Store", false, true},
+		{"x/y/.DS_Store", false, true},
+		{"x/Thumbs.db", false, true},
+		{"comment", false, false},
+		{"x/file.tmp", false, true},
+		{"x/keep.tmp", false, false},
+		{"projects/p1/build", true, true},
+		{"projects/p1/build", false, false},
+		{"x/projects/p1/build", true, false},
+		{"projects/p1/sub/build", true, false},
+		{"cache/1.log", false, true},
+		{"x/y/cache/1.log", false, true},
+		{"x/y/cache/1.txt", false, false},
+		{"logs", true, true},
+		{"x/logs", true, true},
+		{"x/logs", false, false},
+		{"docs", true, false},
+		{"docs/a/b.txt", false, true},
+		{"a/z", false, true},
+		{"a/b/c/z", false, true},
+		{"b/a/z", false, false},
+		{"#hash", false, true},
+		{"!bang", false, true},
+		{"trailing ", false, true},
+		{"trailing", false, false},
+	} {
+		assert.Equal(t, c.isExcluded, m.Match(c.path, c.isDir), c.path)
+	}
+}
+
+func TestParse(t *testing.T) {
+	_, err := Parse("ok\n[unclosed\n")
+	assert.NotNil(t, err)
+	var nilMatcher *Matcher
+	assert.False(t, nilMatcher.Match("anything", false))
+	assert.True(t, nilMatcher.IsEmpty())
+	m, err := Parse("# nothing\n\n")
+	assert.Nil(t, err)
+	assert.True(t, m.IsEmpty())
+}
@@ -8,9 +8,11 @@ import (
 	_ "embed"
 	"fmt"
 	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/go-find-duplicates/action"
 	"github.com/m-manu/go-find-duplicates/bytesutil"
 	"github.com/m-manu/go-find-duplicates/entity"
 	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/ignore"
 	"github.com/m-manu/go-find-duplicates/service"
 	"github.com/m-manu/go-find-duplicates/utils"
 	flag "github.com/spf13/pflag"
@@ -19,6 +21,8 @@ import (
 	"path/filepath"
 	"runtime"
 	"runtime/debug"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 )
@@ -35,6 +39,13 @@ const (
 	exitCodeInvalidOutputMode
 	exitCodeReportFileCreationFailed
 	exitCodeOutputDirectoryIsNotReadable
+	exitCodeHashCacheNotReadable
+	exitCodeInvalidAction
+	exitCodeActionIncomplete
+	exitCodeInvalidManifest
+	exitCodeInvalidPlan
+	exitCodeInvalidDirectoryMode
+	exitCodeFileListNotReadable
 )
 
 const version = "1.8.0"
@@ -45,28 +56,46 @@ var defaultExclusionsStr string
 var flags struct {
 	isHelp            func() bool
 	getOutputMode     func() string
-	getExcludedFiles  func() set.Set[string]
+	getExclusions     func() *ignore.Matcher
 	getMinSize        func() int64
 	getParallelism    func() int
-	isThorough        func() bool
 	getOutputFilePath func() string
 	getVersion        func() bool
 	isQuiet           func() bool
+	getHashCache      func() *service.HashCache
+	getMaxMemory      func() int64
+	getAction         func() string
+	getKeepStrategy   func() string
+	isRelativeLinks   func() bool
+	getQuarantineDir  func() string
+	getDirectoryMode  func() string
+	getMinOverlap     func() float64
+	isBothWays        func() bool
+	getReferenceDirs  func() []string
+	getMinRoots       func() int
+	isGitignoreUsed   func() bool
+	getMarkerFiles    func() []string
+	isFollowSymlinks  func() bool
+	isOneFileSystem   func() bool
+	getFilesFrom      func() string
+	isNulSeparated    func() bool
 }
 
 func setupExclusionsOpt() {
 	const exclusionsFlag = "exclusions"
 	const exclusionsDefaultValue = ""
-	defaultExclusions, defaultExclusionsExamples := utils.LineSeparatedStrToMap(defaultExclusionsStr)
+	_, defaultExclusionsExamples := utils.LineSeparatedStrToMap(defaultExclusionsStr)
 	excludesListFilePathPtr := flag.StringP(exclusionsFlag, "x", exclusionsDefaultValue,
-		fmt.Sprintf("path to file containing newline-separated list of file/directory names to be excluded\n"+
+		fmt.Sprintf("path to file containing patterns of files/directories to be excluded, in .gitignore format\n"+
+			"(e.g. \"Thumbs.db\", \"**/cache/*.tmp\" or \"/projects/*/build/\", where a leading \"/\" anchors a pattern to\n"+
+			"the input directory)\n"+
 			"(if this is not set, by default these will be ignored:\n%s etc.)",
 			strings.Join(defaultExclusionsExamples, ", ")))
-	flags.getExcludedFiles = func() set.Set[string] {
+	flags.getExclusions = func() *ignore.Matcher {
 		excludesListFilePath := *excludesListFilePathPtr
-		var exclusions set.Set[string]
+		var exclusions *ignore.Matcher
 		if excludesListFilePath == exclusionsDefaultValue {
-			exclusions = defaultExclusions
+			exclusions = ignore.MustParse(defaultExclusionsStr)
 		} else {
 			if !utils.IsReadableFile(excludesListFilePath) {
 				fmte.PrintfErr("error: argument to flag --%s should be a readable file\n", exclusionsFlag)
@@ -79,13 +108,68 @@ func setupExclusionsOpt() {
 				flag.Usage()
 				os.Exit(exitCodeExclusionFilesError)
 			}
-			contents := strings.ReplaceAll(string(rawContents), "\r\n", "\n") // Windows
-			exclusions, _ = utils.LineSeparatedStrToMap(contents)
+			var parseErr error
+			exclusions, parseErr = ignore.Parse(string(rawContents))
+			if parseErr != nil {
+				fmte.PrintfErr("error: invalid exclusions file: %+v\n", parseErr)
+				os.Exit(exitCodeInvalidExclusions)
+			}
 		}
 		return exclusions
 	}
 }
 
+func setupGitignoreOpt() {
+	gitignorePtr := flag.Bool("gitignore", false,
+		"skip files/directories as per .gitignore files found while scanning (like those in .fdignore files,\n"+
+			"which are always honoured)")
+	flags.isGitignoreUsed = func() bool {
+		return *gitignorePtr
+	}
+}
+
+func setupFollowSymlinksOpt() {
+	followSymlinksPtr := flag.Bool("follow-symlinks", false,
+		"follow symbolic links to files and directories (files reached through links are reported, but never acted\n"+
+			"upon)")
+	flags.isFollowSymlinks = func() bool {
+		return *followSymlinksPtr
+	}
+}
+
+func setupOneFileSystemOpt() {
+	oneFileSystemPtr := flag.Bool("one-file-system", false,
+		"don't scan directories on file systems other than those of the input directories (i.e. mount points)")
+	flags.isOneFileSystem = func() bool {
+		return *oneFileSystemPtr
+	}
+}
+
+func setupFilesFromOpt() {
+	filesFromPtr := flag.String("files-from", "",
+		"find duplicates among files listed in this file (or in standard input, if it's '-'), one per line,\n"+
+			"instead of scanning input directories (.fdignore files, cache directories and marker files aren't\n"+
+			"looked for, and files listed aren't in any input directory, so --gitignore, --marker, --min-roots and\n"+
+			"--one-file-system can't be used with this)")
+	nulSeparatedPtr := flag.BoolP("null", "0", false,
+		"with --files-from, files listed are separated by NUL characters (e.g. output of 'find -print0')")
+	flags.getFilesFrom = func() string {
+		return *filesFromPtr
+	}
+	flags.isNulSeparated = func() bool {
+		return *nulSeparatedPtr
+	}
+}
+
+func setupMarkerOpt() {
+	markerFilesPtr := flag.StringArray("marker", nil,
+		"name of a marker file (e.g. .nodedupe) that makes the directory it's in be skipped (can be passed multiple\n"+
+			"times; cache directories tagged with a CACHEDIR.TAG file are always skipped)")
+	flags.getMarkerFiles = func() []string {
+		return *markerFilesPtr
+	}
+}
+
 func setupHelpOpt() {
 	helpPtr := flag.BoolP("help", "h", false, "display help")
 	flags.isHelp = func() bool {
@@ -94,12 +178,9 @@ func setupHelpOpt() {
 }
 
 func setupThoroughOpt() {
-	thoroughPtr := flag.BoolP("thorough", "t", false,
-		"apply thorough check of uniqueness of files\n(caution: this makes the scan very slow!)",
-	)
-	flags.isThorough = func() bool {
-		return *thoroughPtr
-	}
+	flag.BoolP("thorough", "t", false, "apply thorough check of uniqueness of files")
+	_ = flag.CommandLine.MarkDeprecated("thorough",
+		"entire contents of files that may be duplicates are now always compared")
 }
 
 func setupMinSizeOpt() {
@@ -111,10 +192,18 @@ func setupMinSizeOpt() {
 	}
 }
 
+func setupMaxMemoryOpt() {
+	maxMemoryPtr := flag.Uint64("max-memory", 0,
+		"maximum memory in MiB that all parallel workers together may use for reading files (0 means no limit)")
+	flags.getMaxMemory = func() int64 {
+		return int64(*maxMemoryPtr) * bytesutil.MEBI
+	}
+}
+
 func setupParallelismOpt() {
 	const defaultParallelismValue = 0
 	parallelismPtr := flag.Uint8P("parallelism", "p", defaultParallelismValue,
-		"extent of parallelism (defaults to number of cores minus 1)")
+		"extent of parallelism, for both scanning directories and hashing files (defaults to number of cores minus 1)")
 	flags.getParallelism = func() int {
 		if *parallelismPtr == defaultParallelismValue {
 			n := runtime.NumCPU()
@@ -127,13 +216,26 @@ func setupParallelismOpt() {
 	}
 }
 
-func setupOutputModeOpt() {
+// describeChoices describes choices for a flag, in sorted order
+func describeChoices(title string, choices map[string]string) string {
+	names := make([]string, 0, len(choices))
+	width := 0
+	for name := range choices {
+		names = append(names, name)
+		width = max(width, len(name))
+	}
+	sort.Strings(names)
 	var sb strings.Builder
-	sb.WriteString("following modes are accepted:\n")
-	for outputMode, description := range entity.OutputModes {
-		sb.WriteString(fmt.Sprintf("%5s = %s\n", outputMode, description))
+	sb.WriteString(title + "\n")
+	for _, name := range names {
+		sb.WriteString(fmt.Sprintf("%*s = %s\n", width, name, choices[name]))
 	}
-	outputModeStrPtr := flag.StringP("output", "o", entity.OutputModeTextFile, sb.String())
+	return sb.String()
+}
+
+func setupOutputModeOpt() {
+	outputModeStrPtr := flag.StringP("output", "o", entity.OutputModeTextFile,
+		describeChoices("following modes are accepted:", entity.OutputModes))
 	flags.getOutputMode = func() string {
 		outputModeStr := strings.ToLower(strings.TrimSpace(*outputModeStrPtr))
 		if _, exists := entity.OutputModes[outputModeStr]; !exists {
@@ -144,6 +246,115 @@ func setupOutputModeOpt() {
 	}
 }
 
+func setupActionOpt() {
+	actionStrPtr := flag.StringP("action", "a", entity.ActionNone,
+		strings.TrimSpace(describeChoices("action to perform on duplicates after reporting them (by default, none):",
+			entity.Actions)))
+	flags.getAction = func() string {
+		actionStr := strings.ToLower(strings.TrimSpace(*actionStrPtr))
+		if _, exists := entity.Actions[actionStr]; !exists && actionStr != entity.ActionNone {
+			fmte.PrintfErr("error: invalid action '%s'\n", actionStr)
+			os.Exit(exitCodeInvalidAction)
+		}
+		return actionStr
+	}
+}
+
+func setupKeepOpt() {
+	keepStrPtr := flag.StringP("keep", "k", entity.KeepOldest,
+		describeChoices("file to keep in every group of duplicates, when an action is performed:",
+			entity.KeepStrategies))
+	flags.getKeepStrategy = func() string {
+		keepStr := strings.ToLower(strings.TrimSpace(*keepStrPtr))
+		if _, exists := entity.KeepStrategies[keepStr]; !exists {
+			fmte.PrintfErr("error: invalid keep strategy '%s'\n", keepStr)
+			os.Exit(exitCodeInvalidAction)
+		}
+		return keepStr
+	}
+}
+
+func setupRelativeLinksOpt() {
+	relativeLinksPtr := flag.Bool("relative-links", false,
+		"with action '"+entity.ActionSymlink+"', link to the file kept using a relative path (instead of absolute)")
+	flags.isRelativeLinks = func() bool {
+		return *relativeLinksPtr
+	}
+}
+
+func setupQuarantineDirOpt() {
+	const quarantineDirFlag = "quarantine-dir"
+	quarantineDirPtr := flag.String(quarantineDirFlag, "",
+		"with action '"+entity.ActionQuarantine+"', directory to which duplicates are moved "+
+			"(can't be inside the directories scanned)")
+	flags.getQuarantineDir = func() string {
+		if *quarantineDirPtr == "" {
+			if flags.getAction() == entity.ActionQuarantine {
+				fmte.PrintfErr("error: flag --%s is needed for action '%s'\n", quarantineDirFlag,
+					entity.ActionQuarantine)
+				os.Exit(exitCodeInvalidAction)
+			}
+			return ""
+		}
+		abs, _ := filepath.Abs(*quarantineDirPtr)
+		return abs
+	}
+}
+
+func setupDirsOpt() {
+	dirsStrPtr := flag.String("dirs", entity.DirectoryModeNone,
+		strings.TrimSpace(describeChoices("also find duplicate directories, of following kind (by default, not done):",
+			entity.DirectoryModes)))
+	flags.getDirectoryMode = func() string {
+		dirsStr := strings.ToLower(strings.TrimSpace(*dirsStrPtr))
+		if _, exists := entity.DirectoryModes[dirsStr]; !exists && dirsStr != entity.DirectoryModeNone {
+			fmte.PrintfErr("error: invalid kind of duplicate directories '%s'\n", dirsStr)
+			os.Exit(exitCodeInvalidDirectoryMode)
+		}
+		return dirsStr
+	}
+}
+
+func setupOverlapOpt() {
+	const overlapFlag = "overlap"
+	minOverlapPtr := flag.Uint(overlapFlag, 0,
+		"also report pairs of directories where one has all its contents in the other, or both share more than\n"+
+			"this percentage (1 to 100) of their contents by size (by default, not done)")
+	flags.getMinOverlap = func() float64 {
+		if *minOverlapPtr > 100 {
+			fmte.PrintfErr("error: argument to flag --%s should be a percentage\n", overlapFlag)
+			os.Exit(exitCodeInvalidDirectoryMode)
+		}
+		return float64(*minOverlapPtr)
+	}
+}
+
+func setupBothOpt() {
+	bothPtr := flag.Bool("both", false,
+		"with command '"+commandCompare+"', also report files in target whose contents are found nowhere in source")
+	flags.isBothWays = func() bool {
+		return *bothPtr
+	}
+}
+
+func setupReferenceOpt() {
+	referenceDirsPtr := flag.StringArray("reference", nil,
+		"reference directory (can be passed multiple times): it's scanned along with input directories, but files in\n"+
+			"it are never acted upon, are kept in preference to other files and aren't reported if they are\n"+
+			"duplicates of just each other")
+	flags.getReferenceDirs = func() []string {
+		return *referenceDirsPtr
+	}
+}
+
+func setupMinRootsOpt() {
+	minRootsPtr := flag.Uint("min-roots", 0,
+		"report only duplicates that are found in at least these many of the input directories")
+	flags.getMinRoots = func() int {
+		return int(*minRootsPtr)
+	}
+}
+
 const DefaultFileName = ""
 
 func setupOutputFileOpt() {
@@ -176,19 +387,37 @@ func setupQuietOpt() {
 	}
 }
 
+func setupCacheOpt() {
+	const defaultCacheValue = ""
+	cacheFilePathPtr := flag.String("cache", defaultCacheValue,
+		"path to a file in which hashes are cached across runs, so that unchanged files aren't read again\n"+
+			"(e.g. ~/.cache/go-find-duplicates/index.db; created if it doesn't exist)")
+	flags.getHashCache = func() *service.HashCache {
+		if *cacheFilePathPtr == defaultCacheValue {
+			return nil
+		}
+		cache, err := service.OpenHashCache(*cacheFilePathPtr)
+		if err != nil {
+			fmte.PrintfErr("error: %+v\n", err)
+			os.Exit(exitCodeHashCacheNotReadable)
+		}
+		return cache
+	}
+}
+
 func setupUsage() {
 	flag.Usage = func() {
 		fmte.PrintfErr("Run \"go-find-duplicates --help\" for usage\n")
 	}
 }
 
-func readDirectories() (directories []string) {
-	if flag.NArg() < 1 {
+func readDirectories(args []string) (directories []string) {
+	if len(args) < 1 {
 		fmte.PrintfErr("error: no input directories passed\n")
 		flag.Usage()
 		os.Exit(exitCodeInvalidNumArgs)
 	}
-	for i, p := range flag.Args() {
+	for i, p := range args {
 		if !utils.IsReadableDirectory(p) {
 			fmte.PrintfErr("error: input #%d \"%v\" isn't a readable directory\n", i+1, p)
 			flag.Usage()
@@ -200,6 +429,37 @@ func readDirectories() (directories []string) {
 	return directories
 }
 
+// readFileList reads the list of files from the file (or from standard input, if it's "-")
+func readFileList(filesFrom string) []string {
+	r := os.Stdin
+	if filesFrom != "-" {
+		f, openErr := os.Open(filesFrom)
+		if openErr != nil {
+			fmte.PrintfErr("error: couldn't open list of files: %+v\n", openErr)
+			os.Exit(exitCodeFileListNotReadable)
+		}
+		defer f.Close()
+		r = f
+	}
+	paths, readErr := service.ReadFileList(r, flags.isNulSeparated())
+	if readErr != nil {
+		fmte.PrintfErr("error: couldn't read list of files: %+v\n", readErr)
+		os.Exit(exitCodeFileListNotReadable)
+	}
+	return paths
+}
+
+func getScanOptions() service.ScanOptions {
+	return service.ScanOptions{
+		Exclusions:        flags.getExclusions(),
+		FileSizeThreshold: flags.getMinSize(),
+		UseGitignore:      flags.isGitignoreUsed(),
+		MarkerFileNames:   flags.getMarkerFiles(),
+		FollowSymlinks:    flags.isFollowSymlinks(),
+		OneFileSystem:     flags.isOneFileSystem(),
+	}
+}
+
 func handlePanic() {
 	err := recover()
 	if err != nil {
@@ -216,9 +476,20 @@ func showHelpAndExit() {
 
 Usage:
   go-find-duplicates [flags] <dir-1> <dir-2> ... <dir-n>
+  go-find-duplicates [flags] --files-from <list-file>
+  go-find-duplicates restore <manifest-file> [<path-1> <path-2> ... <path-n>]
+  go-find-duplicates apply <plan-file>
+  go-find-duplicates compare <source-dir> <target-dir>
 
 where,
-  arguments are readable directories that need to be scanned for duplicates
+  arguments are readable directories that need to be scanned for duplicates (unless files are listed using
+  --files-from)
+  'restore' moves files quarantined earlier back to their original locations (only those under the given paths,
+  if any paths are passed)
+  'apply' carries out a plan created earlier using output mode 'plan' (and possibly edited since)
+  'compare' reports files in source directory whose contents are found nowhere in target directory (e.g. to check
+  whether a backup is complete)
+  (a directory with the same name as a command, e.g. './compare', is scanned for duplicates instead)
 
 Flags (all optional):
 `)
@@ -232,14 +503,30 @@ For more details: https://github.com/m-manu/go-find-duplicates
 func setupFlags() {
 	setupUsage()
 	setupExclusionsOpt()
+	setupGitignoreOpt()
+	setupMarkerOpt()
+	setupFollowSymlinksOpt()
+	setupOneFileSystemOpt()
+	setupFilesFromOpt()
 	setupHelpOpt()
 	setupMinSizeOpt()
 	setupOutputModeOpt()
 	setupParallelismOpt()
+	setupMaxMemoryOpt()
 	setupThoroughOpt()
 	setupVersionOpt()
 	setupQuietOpt()
 	setupOutputFileOpt()
+	setupCacheOpt()
+	setupActionOpt()
+	setupKeepOpt()
+	setupRelativeLinksOpt()
+	setupQuarantineDirOpt()
+	setupDirsOpt()
+	setupOverlapOpt()
+	setupBothOpt()
+	setupReferenceOpt()
+	setupMinRootsOpt()
 }
 
 func generateRunID() string {
@@ -255,6 +542,10 @@ func createReportFileIfApplicable(runID string, outputMode string) (string, io.W
 		reportFileName = fmt.Sprintf("./duplicates_%s.txt", runID)
 	case entity.OutputModeJSON:
 		reportFileName = fmt.Sprintf("./duplicates_%s.json", runID)
+	case entity.OutputModePlan:
+		reportFileName = fmt.Sprintf("./plan_%s.txt", runID)
+	case entity.OutputModeScript:
+		reportFileName = fmt.Sprintf("./duplicates_%s.sh", runID)
 	default:
 		panic("unsupported output mode - bug in code")
 	}
@@ -266,6 +557,114 @@ func createReportFileIfApplicable(runID string, outputMode string) (string, io.W
 	return reportFileName, f
 }
 
+// Commands that, when passed as the first argument, make this program do something other than finding duplicates
+const (
+	commandRestore = "restore"
+	commandApply   = "apply"
+	commandCompare = "compare"
+)
+
+// commandOf gets the command passed as the first argument, if any. An argument that's also the name of a directory
+// (e.g. a directory named "compare" in the current directory) is taken to be a directory to be scanned.
+func commandOf(args []string) string {
+	if len(args) == 0 || utils.IsReadableDirectory(args[0]) {
+		return ""
+	}
+	return args[0]
+}
+
+func runRestore(args []string) {
+	if len(args) < 1 {
+		fmte.PrintfErr("error: no manifest file passed\n")
+		flag.Usage()
+		os.Exit(exitCodeInvalidNumArgs)
+	}
+	var paths []string
+	for _, p := range args[1:] {
+		abs, _ := filepath.Abs(p)
+		paths = append(paths, abs)
+	}
+	summary, err := action.Restore(args[0], paths)
+	printRestoreSummary(summary)
+	if err != nil {
+		fmte.PrintfErr("error: %+v\n", err)
+		os.Exit(exitCodeInvalidManifest)
+	}
+	if len(summary.Failed) > 0 {
+		os.Exit(exitCodeActionIncomplete)
+	}
+}
+
+func runApply(args []string) {
+	if len(args) != 1 {
+		fmte.PrintfErr("error: exactly one plan file needs to be passed\n")
+		flag.Usage()
+		os.Exit(exitCodeInvalidNumArgs)
+	}
+	summary, err := action.Apply(args[0])
+	if err != nil {
+		fmte.PrintfErr("error: %+v\n", err)
+		os.Exit(exitCodeInvalidPlan)
+	}
+	printActionSummary(commandApply, summary, -1)
+	if len(summary.Failed) > 0 {
+		os.Exit(exitCodeActionIncomplete)
+	}
+}
+
+func runCompare(args []string, runID string) {
+	if len(args) != 2 {
+		fmte.PrintfErr("error: exactly two directories (source and target) need to be passed\n")
+		flag.Usage()
+		os.Exit(exitCodeInvalidNumArgs)
+	}
+	directories := readDirectories(args)
+	source, target := directories[0], directories[1]
+	outputMode := flags.getOutputMode()
+	if outputMode != entity.OutputModeTextFile && outputMode != entity.OutputModeStdOut {
+		fmte.PrintfErr("error: command '%s' supports only output modes '%s' and '%s'\n", commandCompare,
+			entity.OutputModeTextFile, entity.OutputModeStdOut)
+		os.Exit(exitCodeInvalidOutputMode)
+	}
+	reportFileName := flags.getOutputFilePath()
+	var reportFile io.Writer = os.Stdout
+	if outputMode == entity.OutputModeTextFile {
+		if reportFileName == DefaultFileName {
+			reportFileName = fmt.Sprintf("./missing_%s.txt", runID)
+		}
+		f, fErr := os.Create(reportFileName)
+		if fErr != nil {
+			fmte.PrintfErr("error: couldn't create report file: %+v\n", fErr)
+			os.Exit(exitCodeReportFileCreationFailed)
+		}
+		defer f.Close()
+		reportFile = f
+	}
+	hashCache := flags.getHashCache()
+	sourceOnly, targetOnly, sourceFiles, targetFiles, cErr := service.CompareDirectories(source, target,
+		getScanOptions(), flags.getParallelism(), hashCache, flags.getMaxMemory())
+	if cErr != nil {
+		fmte.PrintfErr("error while comparing directories: %+v\n", cErr)
+		os.Exit(exitCodeErrorFindingDuplicates)
+	}
+	if sErr := hashCache.Save(); sErr != nil {
+		fmte.PrintfErr("error while saving hash cache: %+v\n", sErr)
+	}
+	fmte.Printf("Found %d files in %s whose contents are missing from %s.\n", len(sourceOnly), source, target)
+	rErr := reportMissingFiles(source, target, sourceOnly, sourceFiles, reportFile)
+	if rErr == nil && flags.isBothWays() {
+		fmte.Printf("Found %d files in %s whose contents are missing from %s.\n", len(targetOnly), target, source)
+		rErr = reportMissingFiles(target, source, targetOnly, targetFiles, reportFile)
+	}
+	if rErr != nil {
+		fmte.PrintfErr("error while reporting to file: %+v\n", rErr)
+		os.Exit(exitCodeErrorCreatingReport)
+	}
+	if outputMode == entity.OutputModeTextFile {
+		fmte.Printf("View report here: %s\n", reportFileName)
+	}
+}
+
 func main() {
 	defer handlePanic()
 	runID := generateRunID()
@@ -284,9 +683,82 @@ func main() {
 	if flags.isQuiet() {
 		fmte.Off()
 	}
+	switch commandOf(flag.Args()) {
+	case commandRestore:
+		runRestore(flag.Args()[1:])
+		return
+	case commandApply:
+		runApply(flag.Args()[1:])
+		return
+	case commandCompare:
+		runCompare(flag.Args()[1:], runID)
+		return
+	}
 
-	directories := readDirectories()
+	filesFrom := flags.getFilesFrom()
+	var directories, listedFiles []string
+	referenceDirectories := set.NewSet[string]()
+	if filesFrom != "" {
+		if flag.NArg() > 0 || len(flags.getReferenceDirs()) > 0 {
+			fmte.PrintfErr("error: input directories can't be passed along with --files-from\n")
+			flag.Usage()
+			os.Exit(exitCodeInvalidNumArgs)
+		}
+		for _, name := range []string{"gitignore", "marker", "min-roots", "one-file-system"} {
+			if flag.CommandLine.Changed(name) {
+				fmte.PrintfErr("error: --%s can't be used with --files-from, as it applies only to directories scanned\n",
+					name)
+				os.Exit(exitCodeInvalidNumArgs)
+			}
+		}
+		listedFiles = readFileList(filesFrom)
+	} else {
+		directories = readDirectories(flag.Args())
+		if len(flags.getReferenceDirs()) > 0 {
+			for _, dir := range readDirectories(flags.getReferenceDirs()) {
+				referenceDirectories.Add(dir)
+				directories = append(directories, dir)
+			}
+		}
+	}
 	outputMode := flags.getOutputMode()
+	actionName := flags.getAction()
+	keepStrategy := flags.getKeepStrategy()
+	quarantineDir := flags.getQuarantineDir()
+	if actionName == entity.ActionQuarantine {
+		for _, dir := range directories {
+			if utils.IsUnder(utils.ResolvePath(quarantineDir), utils.ResolvePath(dir)) {
+				fmte.PrintfErr("error: quarantine directory can't be inside input directory \"%s\" (files "+
+					"quarantined would then be found as duplicates of files kept)\n", dir)
+				os.Exit(exitCodeInvalidAction)
+			}
+		}
+	}
+	if outputMode == entity.OutputModeScript && !slices.Contains(action.ScriptActions, actionName) {
+		fmte.PrintfErr("error: action '%s' can't be performed by a script\n", actionName)
+		os.Exit(exitCodeInvalidAction)
+	}
+	if outputMode == entity.OutputModePlan && !slices.Contains(action.PlanActions, actionName) {
+		fmte.PrintfErr("error: action '%s' can't be proposed in a plan (only '%s' and '%s' can be)\n", actionName,
+			entity.ActionDelete, entity.ActionHardLink)
+		os.Exit(exitCodeInvalidAction)
+	}
+	directoryMode := flags.getDirectoryMode()
+	if directoryMode != entity.DirectoryModeNone && (actionName != entity.ActionNone ||
+		outputMode == entity.OutputModePlan || outputMode == entity.OutputModeScript) {
+		fmte.PrintfErr("error: duplicate directories can only be reported (not acted upon)\n")
+		os.Exit(exitCodeInvalidDirectoryMode)
+	}
+	minOverlap := flags.getMinOverlap()
+	if filesFrom != "" && (directoryMode != entity.DirectoryModeNone || minOverlap > 0) {
+		fmte.PrintfErr("error: duplicate or overlapping directories can't be found among files listed\n")
+		os.Exit(exitCodeInvalidDirectoryMode)
+	}
+	if minOverlap > 0 && outputMode != entity.OutputModeTextFile && outputMode != entity.OutputModeStdOut {
+		fmte.PrintfErr("error: overlapping directories can only be reported in output modes '%s' and '%s'\n",
+			entity.OutputModeTextFile, entity.OutputModeStdOut)
+		os.Exit(exitCodeInvalidOutputMode)
+	}
 	reportFileName := flags.getOutputFilePath()
 	var reportFile io.Writer
 	var fErr error
@@ -304,13 +776,41 @@ func main() {
 		}
 	}
 
-	duplicates, duplicateTotalCount, savingsSize, allFiles, fdErr :=
-		service.FindDuplicates(directories, flags.getExcludedFiles(), flags.getMinSize(),
-			flags.getParallelism(), flags.isThorough())
+	hashCache := flags.getHashCache()
+	var duplicates *entity.DigestToFiles
+	var duplicateTotalCount, savingsSize int64
+	var allFiles entity.FilePathToMeta
+	var fdErr error
+	if filesFrom != "" {
+		duplicates, duplicateTotalCount, savingsSize, allFiles, fdErr = service.FindDuplicatesOfFiles(listedFiles,
+			getScanOptions(), flags.getParallelism(), hashCache, flags.getMaxMemory())
+	} else {
+		duplicates, duplicateTotalCount, savingsSize, allFiles, fdErr = service.FindDuplicates(directories,
+			referenceDirectories, getScanOptions(), flags.getParallelism(), hashCache, flags.getMaxMemory())
+	}
 	if fdErr != nil {
 		fmte.PrintfErr("error while finding duplicates: %+v\n", fdErr)
 		os.Exit(exitCodeErrorFindingDuplicates)
 	}
+	if cErr := hashCache.Save(); cErr != nil {
+		fmte.PrintfErr("error while saving hash cache: %+v\n", cErr)
+	}
+	var rootSharedSizes [][]int64
+	if len(directories) > 1 && duplicates != nil {
+		rootSharedSizes = service.SharedSizesOfRoots(duplicates, allFiles, len(directories))
+	}
+	if flags.getMinRoots() > 1 && duplicates != nil {
+		duplicates, duplicateTotalCount, savingsSize = service.FilterByRootCount(duplicates, allFiles,
+			flags.getMinRoots())
+	}
+	var overlaps []entity.DirectoryOverlap
+	if minOverlap > 0 && duplicates != nil && duplicates.Size() > 0 {
+		overlaps = service.FindOverlappingDirectories(duplicates, allFiles, directories, minOverlap)
+	}
+	if directoryMode != entity.DirectoryModeNone && duplicates != nil && duplicates.Size() > 0 {
+		duplicates, duplicateTotalCount, savingsSize = service.FindDuplicateDirectories(duplicates, allFiles,
+			directories, directoryMode)
+	}
 	if duplicates == nil || duplicates.Size() == 0 {
 		if len(allFiles) == 0 {
 			fmte.Printf("No actions performed!\n")
@@ -321,13 +821,48 @@ func main() {
 	}
 	fmte.Printf("Found %d duplicates. A total of %s can be saved by removing them.\n",
 		duplicateTotalCount, bytesutil.BinaryFormat(savingsSize))
+	if rootSharedSizes != nil {
+		printRootSharedSizes(directories, rootSharedSizes)
+	}
 
-	dErr := reportDuplicates(duplicates, outputMode, allFiles, runID, reportFile)
+	actionOptions := action.Options{
+		Action:        actionName,
+		Keep:          keepStrategy,
+		RelativeLinks: flags.isRelativeLinks(),
+		QuarantineDir: quarantineDir,
+		RunID:         runID,
+	}
+	dErr := reportDuplicates(duplicates, outputMode, allFiles, service.FindHardLinks(allFiles), runID, reportFile,
+		actionOptions)
 	if dErr != nil {
 		fmte.PrintfErr("error while reporting to file: %+v\n", dErr)
 		os.Exit(exitCodeErrorCreatingReport)
 	}
+	if minOverlap > 0 {
+		if oErr := reportOverlaps(overlaps, minOverlap, reportFile); oErr != nil {
+			fmte.PrintfErr("error while reporting to file: %+v\n", oErr)
+			os.Exit(exitCodeErrorCreatingReport)
+		}
+	}
+	if outputMode == entity.OutputModePlan {
+		fmte.Printf("Review (and edit) the plan here: %s\n"+
+			"Once done, carry it out using: go-find-duplicates %s %s\n", reportFileName, commandApply, reportFileName)
+		return
+	}
+	if outputMode == entity.OutputModeScript {
+		fmte.Printf("Review the script here: %s\nOnce done, run it using: sh %s\n", reportFileName, reportFileName)
+		return
+	}
 	if reportFileName != DefaultFileName {
 		fmte.Printf("View duplicates report here: %s\n", reportFileName)
 	}
+	if actionName == entity.ActionNone {
+		return
+	}
+	fmte.Printf("Performing action '%s' on duplicates...\n", actionName)
+	summary := action.Perform(duplicates, allFiles, actionOptions)
+	printActionSummary(actionName, summary, savingsSize)
+	if len(summary.Failed) > 0 {
+		os.Exit(exitCodeActionIncomplete)
+	}
 }
@@ -10,33 +10,47 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/m-manu/go-find-duplicates/action"
+	"github.com/m-manu/go-find-duplicates/bytesutil"
 	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/fmte"
 )
 
 const bytesPerLineGuess = 500
 
+// reportDuplicates reports duplicates in the given output mode. Paths that are hard links to a duplicate (see
+// service.FindHardLinks) are reported as "already linked" to it, and paths reached through symbolic links are marked as
+// such, in modes other than plan and script.
 func reportDuplicates(duplicates *entity.DigestToFiles, outputMode string, allFiles entity.FilePathToMeta,
-	runID string, reportFile io.Writer) error {
+	hardLinks map[string][]string, runID string, reportFile io.Writer, actionOptions action.Options) error {
 	var err error
 	if outputMode == entity.OutputModeStdOut {
-		printReportToStdOut(runID, duplicates)
+		printReportToStdOut(runID, duplicates, allFiles, hardLinks)
 	} else if outputMode == entity.OutputModeTextFile {
-		err = createTextFileReport(duplicates, reportFile)
+		err = createTextFileReport(duplicates, allFiles, hardLinks, reportFile)
 	} else if outputMode == entity.OutputModeCsvFile {
-		err = createCsvReport(duplicates, allFiles, reportFile)
+		err = createCsvReport(duplicates, allFiles, hardLinks, reportFile)
 	} else if outputMode == entity.OutputModeJSON {
-		err = createJSONReport(duplicates, reportFile)
+		err = createJSONReport(duplicates, allFiles, hardLinks, reportFile)
+	} else if outputMode == entity.OutputModePlan {
+		err = action.WritePlan(reportFile, duplicates, allFiles, actionOptions)
+	} else if outputMode == entity.OutputModeScript {
+		err = action.WriteScript(reportFile, duplicates, allFiles, actionOptions)
 	}
 	return err
 }
 
-func createTextFileReport(duplicates *entity.DigestToFiles, reportFile io.Writer) error {
-	reportBB := getReportAsText(duplicates)
+func createTextFileReport(duplicates *entity.DigestToFiles, allFiles entity.FilePathToMeta,
+	hardLinks map[string][]string, reportFile io.Writer,
+) error {
+	reportBB := getReportAsText(duplicates, allFiles, hardLinks)
 	_, rcErr := reportFile.Write(reportBB.Bytes())
 	return rcErr
 }
 
-func getReportAsText(duplicates *entity.DigestToFiles) bytes.Buffer {
+func getReportAsText(duplicates *entity.DigestToFiles, allFiles entity.FilePathToMeta,
+	hardLinks map[string][]string,
+) bytes.Buffer {
 	var bb bytes.Buffer
 	bb.Grow(duplicates.Size() * bytesPerLineGuess)
 	for iter := duplicates.Iterator(); iter.HasNext(); {
@@ -44,14 +58,27 @@ func getReportAsText(duplicates *entity.DigestToFiles) bytes.Buffer {
 		sort.Strings(paths)
 		bb.WriteString(fmt.Sprintf("%s: %d duplicate(s)\n", digest, len(paths)-1))
 		for _, path := range paths {
-			bb.WriteString(fmt.Sprintf("\t%s\n", path))
+			bb.WriteString(fmt.Sprintf("\t%s%s\n", path, viaLinkMarker(allFiles, path)))
+			for _, linkedPath := range hardLinks[path] {
+				bb.WriteString(fmt.Sprintf("\t\talready linked: %s%s\n", linkedPath, viaLinkMarker(allFiles, linkedPath)))
+			}
 		}
 	}
 	return bb
 }
 
-func printReportToStdOut(runID string, duplicates *entity.DigestToFiles) {
-	reportBB := getReportAsText(duplicates)
+// viaLinkMarker returns what follows the path in text reports, if it was reached through symbolic links
+func viaLinkMarker(allFiles entity.FilePathToMeta, path string) string {
+	if allFiles[path].ViaLink {
+		return " (via link)"
+	}
+	return ""
+}
+
+func printReportToStdOut(runID string, duplicates *entity.DigestToFiles, allFiles entity.FilePathToMeta,
+	hardLinks map[string][]string,
+) {
+	reportBB := getReportAsText(duplicates, allFiles, hardLinks)
 	fmt.Printf(`
 ==========================
 Report (run id %s)
@@ -60,20 +87,34 @@ Report (run id %s)
 	fmt.Println(reportBB.String())
 }
 
-func createCsvReport(duplicates *entity.DigestToFiles, allFiles entity.FilePathToMeta, reportFile io.Writer) error {
+func createCsvReport(duplicates *entity.DigestToFiles, allFiles entity.FilePathToMeta, hardLinks map[string][]string,
+	reportFile io.Writer) error {
 	var bb bytes.Buffer
 	bb.Grow(duplicates.Size() * bytesPerLineGuess)
 	cf := csv.NewWriter(&bb)
-	_ = cf.Write([]string{"file hash", "file size", "last modified", "file path"})
+	_ = cf.Write([]string{"file hash", "file size", "last modified", "file path", "already linked to", "via link"})
+	writeRow := func(digest *entity.FileDigest, path string, linkedTo string) {
+		lastModified, viaLink := "", ""
+		if meta, exists := allFiles[path]; exists { // directories have no metadata
+			lastModified = time.Unix(meta.ModifiedTimestamp, 0).Format("02-Jan-2006 03:04:05 PM")
+			viaLink = strconv.FormatBool(meta.ViaLink)
+		}
+		_ = cf.Write([]string{
+			digest.FileHash,
+			strconv.FormatInt(digest.FileSize, 10),
+			lastModified,
+			path,
+			linkedTo,
+			viaLink,
+		})
+	}
 	for iter := duplicates.Iterator(); iter.HasNext(); {
 		digest, paths := iter.Next()
 		for _, path := range paths {
-			_ = cf.Write([]string{
-				digest.FileHash,
-				strconv.FormatInt(digest.FileSize, 10),
-				time.Unix(allFiles[path].ModifiedTimestamp, 0).Format("02-Jan-2006 03:04:05 PM"),
-				path,
-			})
+			writeRow(digest, path, "")
+			for _, linkedPath := range hardLinks[path] {
+				writeRow(digest, linkedPath, path)
+			}
 		}
 	}
 	cf.Flush()
@@ -81,17 +122,41 @@ func createCsvReport(duplicates *entity.DigestToFiles, allFiles entity.FilePathT
 	return err
 }
 
-func createJSONReport(duplicates *entity.DigestToFiles, reportFile io.Writer) error {
+func createJSONReport(duplicates *entity.DigestToFiles, allFiles entity.FilePathToMeta,
+	hardLinks map[string][]string, reportFile io.Writer,
+) error {
 	type duplicateFile struct {
 		entity.FileDigest
-		Paths []string `json:"paths"`
+		Paths   []string            `json:"paths"`
+		Linked  map[string][]string `json:"linked,omitempty"`  // paths already linked to each of the paths
+		ViaLink []string            `json:"viaLink,omitempty"` // paths (of all the above) reached through symbolic links
 	}
 	var duplicatesToMarshall []duplicateFile
 	for iter := duplicates.Iterator(); iter.HasNext(); {
 		digest, paths := iter.Next()
+		var linked map[string][]string
+		var viaLink []string
+		for _, path := range paths {
+			if allFiles[path].ViaLink {
+				viaLink = append(viaLink, path)
+			}
+			if linkedPaths, exists := hardLinks[path]; exists {
+				if linked == nil {
+					linked = make(map[string][]string)
+				}
+				linked[path] = linkedPaths
+				for _, linkedPath := range linkedPaths {
+					if allFiles[linkedPath].ViaLink {
+						viaLink = append(viaLink, linkedPath)
+					}
+				}
+			}
+		}
 		duplicatesToMarshall = append(duplicatesToMarshall, duplicateFile{
 			*digest,
 			paths,
+			linked,
+			viaLink,
 		})
 	}
 	jsonBytes, err := json.Marshal(duplicatesToMarshall)
@@ -101,3 +166,100 @@ func createJSONReport(duplicates *entity.DigestToFiles, reportFile io.Writer) er
 	_, err = reportFile.Write(jsonBytes)
 	return err
 }
+
+func reportOverlaps(overlaps []entity.DirectoryOverlap, minOverlapPercent float64, reportFile io.Writer) error {
+	var bb bytes.Buffer
+	bb.WriteString("\nDirectories whose contents are all found in other directories:\n")
+	for _, o := range overlaps {
+		if !o.IsSubset {
+			continue
+		}
+		if o.OtherUniqueSize == 0 {
+			bb.WriteString(fmt.Sprintf("\t%s has same contents as %s (%s)\n", o.Dir, o.OtherDir,
+				bytesutil.BinaryFormat(o.SharedSize)))
+		} else {
+			bb.WriteString(fmt.Sprintf("\t%s is contained in %s (%s shared, %s only in latter)\n", o.Dir, o.OtherDir,
+				bytesutil.BinaryFormat(o.SharedSize), bytesutil.BinaryFormat(o.OtherUniqueSize)))
+		}
+	}
+	bb.WriteString(fmt.Sprintf("\nDirectories sharing more than %.0f%% of their contents:\n", minOverlapPercent))
+	for _, o := range overlaps {
+		if o.IsSubset {
+			continue
+		}
+		bb.WriteString(fmt.Sprintf("\t%s and %s share %.0f%% (%s shared, %s only in former, %s only in latter)\n",
+			o.Dir, o.OtherDir, o.OverlapPercent(), bytesutil.BinaryFormat(o.SharedSize),
+			bytesutil.BinaryFormat(o.UniqueSize), bytesutil.BinaryFormat(o.OtherUniqueSize)))
+	}
+	_, err := reportFile.Write(bb.Bytes())
+	return err
+}
+
+func reportMissingFiles(dir string, otherDir string, missing []string, files entity.FilePathToMeta,
+	reportFile io.Writer) error {
+	var bb bytes.Buffer
+	bb.Grow(len(missing) * bytesPerLineGuess)
+	var totalSize int64
+	for _, path := range missing {
+		totalSize += files[path].Size
+	}
+	bb.WriteString(fmt.Sprintf("Files in %s whose contents are found nowhere in %s (%d files, %s):\n", dir, otherDir,
+		len(missing), bytesutil.BinaryFormat(totalSize)))
+	for _, path := range missing {
+		bb.WriteString(fmt.Sprintf("\t%s\n", path))
+	}
+	bb.WriteString("\n")
+	_, err := reportFile.Write(bb.Bytes())
+	return err
+}
+
+func printRootSharedSizes(directories []string, sharedSizes [][]int64) {
+	fmte.Printf("Sizes of contents shared between input directories (diagonal: contents that have duplicates):\n")
+	const cellWidth = 12
+	header := fmt.Sprintf("%*s", 4, "")
+	for j := range directories {
+		header += fmt.Sprintf("%*s", cellWidth, fmt.Sprintf("#%d", j+1))
+	}
+	fmte.Printf("%s\n", header)
+	for i := range directories {
+		row := fmt.Sprintf("%4s", fmt.Sprintf("#%d", i+1))
+		for j := range directories {
+			row += fmt.Sprintf("%*s", cellWidth, bytesutil.BinaryFormat(sharedSizes[i][j]))
+		}
+		fmte.Printf("%s\n", row)
+	}
+	for i, dir := range directories {
+		fmte.Printf("where #%d = %s\n", i+1, dir)
+	}
+}
+
+func printActionSummary(actionName string, summary action.Summary, savingsSize int64) {
+	for _, outcome := range summary.Unverified {
+		fmte.PrintfErr("left \"%s\" untouched, as verification failed: %+v\n", outcome.Path, outcome.Err)
+	}
+	for _, outcome := range summary.Skipped {
+		fmte.PrintfErr("skipped \"%s\": %+v\n", outcome.Path, outcome.Err)
+	}
+	for _, outcome := range summary.Failed {
+		fmte.PrintfErr("couldn't %s \"%s\": %+v\n", actionName, outcome.Path, outcome.Err)
+	}
+	fmte.Printf("Action '%s' performed on %d duplicates (%d failed verification, %d skipped, %d failed).\n",
+		actionName, len(summary.Done), len(summary.Unverified), len(summary.Skipped), len(summary.Failed))
+	if savingsSize >= 0 {
+		fmte.Printf("Reclaimed %s (of estimated %s).\n", bytesutil.BinaryFormat(summary.ReclaimedSize),
+			bytesutil.BinaryFormat(savingsSize))
+	} else {
+		fmte.Printf("Reclaimed %s.\n", bytesutil.BinaryFormat(summary.ReclaimedSize))
+	}
+}
+
+func printRestoreSummary(summary action.Summary) {
+	for _, outcome := range summary.Skipped {
+		fmte.PrintfErr("skipped \"%s\": %+v\n", outcome.Path, outcome.Err)
+	}
+	for _, outcome := range summary.Failed {
+		fmte.PrintfErr("couldn't restore \"%s\": %+v\n", outcome.Path, outcome.Err)
+	}
+	fmte.Printf("Restored %d files (%d skipped, %d failed).\n", len(summary.Done), len(summary.Skipped),
+		len(summary.Failed))
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+
+	"github.com/m-manu/go-find-duplicates/action"
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+// duplicatesWithLinks creates a group of duplicates, one of which was reached through a symbolic link and another has
+// a hard link (also reached through a symbolic link) to it
+func duplicatesWithLinks() (*entity.DigestToFiles, entity.FilePathToMeta, map[string][]string) {
+	duplicates := entity.NewDigestToFiles()
+	digest := entity.FileDigest{FileExtension: ".txt", FileSize: 13, FileHash: "h"}
+	duplicates.Set(digest, "/a/one.txt")
+	duplicates.Set(digest, "/b/one.txt")
+	allFiles := entity.FilePathToMeta{
+		"/a/one.txt":    {Size: 13},
+		"/b/one.txt":    {Size: 13, ViaLink: true},
+		"/a/linked.txt": {Size: 13, ViaLink: true},
+	}
+	hardLinks := map[string][]string{"/a/one.txt": {"/a/linked.txt"}}
+	return duplicates, allFiles, hardLinks
+}
+
+func TestTextReport(t *testing.T) {
+	duplicates, allFiles, hardLinks := duplicatesWithLinks()
+	var report bytes.Buffer
+	assert.Nil(t, reportDuplicates(duplicates, entity.OutputModeTextFile, allFiles, hardLinks, "run", &report,
+		action.Options{}))
+	assert.Equal(t, ".txt/h/13 B: 1 duplicate(s)\n"+
+		"\t/a/one.txt\n"+
+		"\t\talready linked: /a/linked.txt (via link)\n"+
+		"\t/b/one.txt (via link)\n", report.String())
+}
+
+func TestTextReportOfDirectories(t *testing.T) {
+	duplicates := entity.NewDigestToFiles()
+	digest := entity.FileDigest{FileSize: 2048, FileHash: "dh", IsDirectory: true}
+	duplicates.Set(digest, "/a/photos/")
+	duplicates.Set(digest, "/b/photos/")
+	var report bytes.Buffer
+	assert.Nil(t, reportDuplicates(duplicates, entity.OutputModeTextFile, entity.FilePathToMeta{}, nil, "run",
+		&report, action.Options{}))
+	assert.Equal(t, "dir dh (2.00 KiB): 1 duplicate(s)\n"+
+		"\t/a/photos/\n"+
+		"\t/b/photos/\n", report.String())
+}
+
+func TestCsvReport(t *testing.T) {
+	duplicates, allFiles, hardLinks := duplicatesWithLinks()
+	var report bytes.Buffer
+	assert.Nil(t, reportDuplicates(duplicates, entity.OutputModeCsvFile, allFiles, hardLinks, "run", &report,
+		action.Options{}))
+	records, err := csv.NewReader(&report).ReadAll()
+	assert.Nil(t, err)
+	assert.Len(t, records, 4)
+	assert.Equal(t, []string{"file hash", "file size", "last modified", "file path", "already linked to", "via link"},
+		records[0])
+	for i, expected := range [][]string{
+		{"/a/one.txt", "", "false"},
+		{"/a/linked.txt", "/a/one.txt", "true"},
+		{"/b/one.txt", "", "true"},
+	} {
+		assert.Equal(t, expected, records[i+1][3:])
+	}
+}
+
+func TestJSONReport(t *testing.T) {
+	duplicates, allFiles, hardLinks := duplicatesWithLinks()
+	var report bytes.Buffer
+	assert.Nil(t, reportDuplicates(duplicates, entity.OutputModeJSON, allFiles, hardLinks, "run", &report,
+		action.Options{}))
+	var groups []struct {
+		Paths   []string            `json:"paths"`
+		Linked  map[string][]string `json:"linked"`
+		ViaLink []string            `json:"viaLink"`
+	}
+	assert.Nil(t, json.Unmarshal(report.Bytes(), &groups))
+	assert.Len(t, groups, 1)
+	assert.Equal(t, []string{"/a/one.txt", "/b/one.txt"}, groups[0].Paths)
+	assert.Equal(t, map[string][]string{"/a/one.txt": {"/a/linked.txt"}}, groups[0].Linked)
+	assert.Equal(t, []string{"/a/linked.txt", "/b/one.txt"}, groups[0].ViaLink)
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/m-manu/go-find-duplicates/bytesutil"
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/utils"
+)
+
+// CompareDirectories finds files in the source directory whose contents are found nowhere in the target directory
+// (sourceOnly), and vice versa (targetOnly). Files are considered to have same contents on the same criteria as
+// FindDuplicates. Duplicates within a directory don't matter: a file is missing from the target, even if it has
+// copies elsewhere in the source.
+func CompareDirectories(source string, target string, scanOptions ScanOptions, parallelism int, cache *HashCache,
+	maxMemory int64) (
+	sourceOnly []string, targetOnly []string, sourceFiles entity.FilePathToMeta, targetFiles entity.FilePathToMeta,
+	err error,
+) {
+	sourceFiles = make(entity.FilePathToMeta, 10_000)
+	targetFiles = make(entity.FilePathToMeta, 10_000)
+	for i, side := range []struct {
+		dir   string
+		files entity.FilePathToMeta
+	}{{source, sourceFiles}, {target, targetFiles}} {
+		fmte.Printf("Scanning %s...\n", side.dir)
+		size, skippedDirs, pErr := populateFilesFromDirectory(side.dir, i, false, scanOptions, parallelism,
+			side.files)
+		if pErr != nil {
+			err = fmt.Errorf("error while scaning directory %s: %+v", side.dir, pErr)
+			return
+		}
+		fmte.Printf("Done. Found %d files of total size %s.\n", len(side.files), bytesutil.BinaryFormat(size))
+		printSkippedDirs(skippedDirs)
+	}
+	// A group is of interest only if it has files from both sides
+	isWanted := func(paths []string) bool {
+		inSource, inTarget := false, false
+		for _, path := range paths {
+			_, isSource := sourceFiles[path]
+			_, isTarget := targetFiles[path]
+			inSource, inTarget = inSource || isSource, inTarget || isTarget
+		}
+		return inSource && inTarget
+	}
+	shortlist := make(entity.FileExtAndSizeToFiles, len(sourceFiles))
+	for _, files := range []entity.FilePathToMeta{sourceFiles, targetFiles} {
+		for path, meta := range files {
+			fileExtAndSize := entity.FileExtAndSize{FileExtension: utils.GetFileExt(path), FileSize: meta.Size}
+			shortlist[fileExtAndSize] = append(shortlist[fileExtAndSize], path)
+		}
+	}
+	groups := make([][]string, 0, len(shortlist))
+	for _, paths := range shortlist {
+		if isWanted(paths) {
+			groups = append(groups, paths)
+		}
+	}
+	fmte.Printf("Comparing %d files that may be found on both sides...\n", countFiles(groups))
+	groups, _ = hashInStages(groups, isWanted, func(path string) bool {
+		return sourceFiles[path].ViaLink || targetFiles[path].ViaLink
+	}, parallelism, cache, newMemoryBudget(maxMemory))
+	found := make(map[string]struct{}, countFiles(groups))
+	for _, paths := range groups {
+		for _, path := range paths {
+			found[path] = struct{}{}
+		}
+	}
+	sourceOnly = filesNotFound(sourceFiles, found)
+	targetOnly = filesNotFound(targetFiles, found)
+	fmte.Printf("Comparison completed.\n")
+	return
+}
+
+// filesNotFound gets files (sorted by path) that aren't in found
+func filesNotFound(files entity.FilePathToMeta, found map[string]struct{}) (notFound []string) {
+	for path := range files {
+		if _, exists := found[path]; !exists {
+			notFound = append(notFound, path)
+		}
+	}
+	sort.Strings(notFound)
+	return notFound
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/m-manu/go-find-duplicates/bytesutil"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareDirectories(t *testing.T) {
+	fmte.Off()
+	dir := t.TempDir()
+	createFiles(t, dir, map[string]string{
+		"source/a.txt":         "backed up",
+		"source/copy/a.txt":    "backed up",
+		"source/b.txt":         "renamed in backup",
+		"source/c.txt":         "not backed up",
+		"source/copy/c.txt":    "not backed up",
+		"source/d.txt":         "same size as e",
+		"target/a.txt":         "backed up",
+		"target/renamed/b.txt": "renamed in backup",
+		"target/e.txt":         "same size as d",
+		"target/f.txt":         "only in target",
+	})
+	source, target := filepath.Join(dir, "source"), filepath.Join(dir, "target")
+	for _, maxMemory := range []int64{0, bytesutil.KIBI} {
+		sourceOnly, targetOnly, sourceFiles, targetFiles, err := CompareDirectories(source, target, ScanOptions{}, 2,
+			nil, maxMemory)
+		assert.Nil(t, err)
+		assert.Equal(t, 6, len(sourceFiles))
+		assert.Equal(t, 4, len(targetFiles))
+		assert.Equal(t, []string{
+			filepath.Join(source, "c.txt"),
+			filepath.Join(source, "copy/c.txt"),
+			filepath.Join(source, "d.txt"),
+		}, sourceOnly)
+		assert.Equal(t, []string{
+			filepath.Join(target, "e.txt"),
+			filepath.Join(target, "f.txt"),
+		}, targetOnly)
+	}
+}
@@ -3,55 +3,227 @@ package service
 import (
 	"errors"
 	"fmt"
-	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/go-find-duplicates/bytesutil"
 	"github.com/m-manu/go-find-duplicates/entity"
 	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/ignore"
+	"github.com/m-manu/go-find-duplicates/utils"
+	"io"
 	"io/fs"
+	"os"
 	"path/filepath"
-	"strings"
+	"sort"
+	"strconv"
 )
 
-// populateFilesFromDirectory scans the given directory and populates the given map with the files
-func populateFilesFromDirectory(dirPathToScan string, exclusions set.Set[string], fileSizeThreshold int64,
-	allFiles entity.FilePathToMeta) (
-	sizeOfScannedFiles int64,
-	err error,
-) {
-	wErr := filepath.WalkDir(dirPathToScan, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			fmte.PrintfErr("skipping \"%s\": %+v\n", path, errors.Unwrap(err))
-			return nil
+// Names of files (in any directory) with patterns of files/directories to be skipped within that directory
+const (
+	ignoreFileName    = ".fdignore"
+	gitignoreFileName = ".gitignore"
+)
+
+// A directory with a file with this name (and contents starting with the signature) is a cache directory, as per the
+// Cache Directory Tagging Specification (https://bford.info/cachedir/)
+const (
+	cacheDirTagFileName  = "CACHEDIR.TAG"
+	cacheDirTagSignature = "Signature: 8a477f597d28d172789f06886806bc55"
+)
+
+// ScanOptions determine the files found while scanning a directory
+type ScanOptions struct {
+	Exclusions        *ignore.Matcher // files and directories to be skipped (matched relative to the directory)
+	FileSizeThreshold int64           // files smaller than this are skipped
+	UseGitignore      bool            // whether .gitignore files are honoured, along with .fdignore files
+	MarkerFileNames   []string        // directories that have a file with any of these names are skipped
+	FollowSymlinks    bool            // whether symbolic links to files and directories are followed
+	OneFileSystem     bool            // whether directories on file systems other than that of the directory are skipped
+}
+
+// scopedMatcher is a matcher from an ignore file, which applies to the directory it's in
+type scopedMatcher struct {
+	dir     string
+	matcher *ignore.Matcher
+}
+
+// ignoreFileNames gets names of ignore files to be honoured, in increasing order of precedence
+func (options ScanOptions) ignoreFileNames() []string {
+	if options.UseGitignore {
+		return []string{gitignoreFileName, ignoreFileName}
+	}
+	return []string{ignoreFileName}
+}
+
+// isExcluded checks whether the path is excluded, either by exclusions (relative to the directory being scanned) or
+// by ignore files found in directories above it. As with .gitignore files, patterns in ignore files of deeper
+// directories take precedence.
+func (options ScanOptions) isExcluded(dirPathToScan string, path string, isDir bool, scoped []scopedMatcher) bool {
+	relPath, relErr := filepath.Rel(dirPathToScan, path)
+	if relErr != nil || relPath == "." {
+		return false
+	}
+	isExcluded := options.Exclusions.Match(filepath.ToSlash(relPath), isDir)
+	for _, sm := range scoped {
+		if rel, err := filepath.Rel(sm.dir, path); err == nil {
+			if excluded, matched := sm.matcher.MatchResult(filepath.ToSlash(rel), isDir); matched {
+				isExcluded = excluded
+			}
 		}
-		// If the file/directory is in excluded allFiles list, ignore it
-		if exclusions.Contains(d.Name()) {
-			if d.IsDir() {
-				return filepath.SkipDir
+	}
+	return isExcluded
+}
+
+// readIgnoreFiles reads ignore files in the directory, if any
+func (options ScanOptions) readIgnoreFiles(dir string) (scoped []scopedMatcher) {
+	for _, name := range options.ignoreFileNames() {
+		contents, readErr := os.ReadFile(filepath.Join(dir, name))
+		if readErr != nil {
+			if !errors.Is(readErr, fs.ErrNotExist) {
+				fmte.PrintfErr("couldn't read \"%s\": %+v\n", filepath.Join(dir, name), readErr)
 			}
-			return nil
+			continue
 		}
-		if _, exists := allFiles[path]; exists {
-			return nil
+		matcher, parseErr := ignore.Parse(string(contents))
+		if parseErr != nil {
+			fmte.PrintfErr("ignoring \"%s\": %+v\n", filepath.Join(dir, name), parseErr)
+			continue
 		}
-		// Ignore dot allFiles (Mac)
-		if strings.HasPrefix(d.Name(), "._") {
-			return nil
+		if !matcher.IsEmpty() {
+			scoped = append(scoped, scopedMatcher{dir: dir, matcher: matcher})
 		}
-		if d.Type().IsRegular() {
-			info, infoErr := d.Info()
-			if infoErr != nil {
-				fmte.PrintfErr("couldn't get metadata of \"%s\": %+v\n", path, infoErr)
-				return nil
-			}
-			if info.Size() < fileSizeThreshold {
-				return nil
-			}
-			allFiles[path] = entity.FileMeta{Size: info.Size(), ModifiedTimestamp: info.ModTime().Unix()}
-			sizeOfScannedFiles += info.Size()
+	}
+	return scoped
+}
+
+// isPruned checks whether the directory is to be skipped entirely, as it's a cache directory or has a marker file
+func (options ScanOptions) isPruned(dir string) bool {
+	if hasCacheDirTag(dir) {
+		return true
+	}
+	for _, name := range options.MarkerFileNames {
+		if _, statErr := os.Lstat(filepath.Join(dir, name)); statErr == nil {
+			return true
 		}
-		return nil
+	}
+	return false
+}
+
+// hasCacheDirTag checks whether the directory has a valid cache directory tag
+func hasCacheDirTag(dir string) bool {
+	f, openErr := os.Open(filepath.Join(dir, cacheDirTagFileName))
+	if openErr != nil {
+		return false
+	}
+	defer f.Close()
+	signature := make([]byte, len(cacheDirTagSignature))
+	_, readErr := io.ReadFull(f, signature)
+	return readErr == nil && string(signature) == cacheDirTagSignature
+}
+
+// printSkippedDirs prints directories that were skipped entirely
+func printSkippedDirs(skippedDirs []string) {
+	if len(skippedDirs) == 0 {
+		return
+	}
+	fmte.Printf("Skipped %d directories that are caches, have marker files or are on other file systems:\n",
+		len(skippedDirs))
+	for _, dir := range skippedDirs {
+		fmte.Printf("\t%s\n", dir)
+	}
+}
+
+// deviceOf gets the device (i.e. file system) the directory is on, given its metadata. This is a variable, so that
+// tests can fake file systems.
+var deviceOf = func(path string, info fs.FileInfo) (device uint64, ok bool) {
+	device, _, ok = utils.GetFileID(info)
+	return device, ok
+}
+
+// deviceSummary is the number and total size of files found on a device
+type deviceSummary struct {
+	device    uint64
+	count     int
+	size      int64
+	firstPath string // first of the paths of files found on the device (in sorted order)
+}
+
+// printDeviceSummary prints the number and total size of files found on every device (i.e. file system), if they
+// were found on more than one
+func printDeviceSummary(allFiles entity.FilePathToMeta) {
+	summaries := summarizeDevices(allFiles)
+	if len(summaries) <= 1 {
+		return
+	}
+	fmte.Printf("Files found on %d devices:\n", len(summaries))
+	for _, summary := range summaries {
+		fmte.Printf("\tdevice %s (e.g. %s): %d files of total size %s\n", strconv.FormatUint(summary.device, 10),
+			filepath.Dir(summary.firstPath), summary.count, bytesutil.BinaryFormat(summary.size))
+	}
+}
+
+// summarizeDevices gets the number and total size of files found on every device, in order of paths of their files
+func summarizeDevices(allFiles entity.FilePathToMeta) []deviceSummary {
+	deviceToSummary := make(map[uint64]*deviceSummary)
+	for path, meta := range allFiles {
+		summary, exists := deviceToSummary[meta.Device]
+		if !exists {
+			summary = &deviceSummary{device: meta.Device, firstPath: path}
+			deviceToSummary[meta.Device] = summary
+		}
+		summary.count++
+		summary.size += meta.Size
+		summary.firstPath = min(summary.firstPath, path)
+	}
+	summaries := make([]deviceSummary, 0, len(deviceToSummary))
+	for _, summary := range deviceToSummary {
+		summaries = append(summaries, *summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].firstPath < summaries[j].firstPath
 	})
-	if wErr != nil {
-		return -1, fmt.Errorf("couldn't scan directory %s: %v", dirPathToScan, wErr)
+	return summaries
+}
+
+// newFileMeta creates metadata of a file found (see entity.FileMeta for what the arguments mean)
+func newFileMeta(info fs.FileInfo, root int, isReference bool, viaLink bool) entity.FileMeta {
+	device, inode, _ := utils.GetFileID(info)
+	numLinks, _ := utils.GetNumLinks(info)
+	return entity.FileMeta{
+		Size:              info.Size(),
+		ModifiedTimestamp: info.ModTime().Unix(),
+		Root:              root,
+		IsReference:       isReference,
+		Device:            device,
+		Inode:             inode,
+		NumLinks:          numLinks,
+		ViaLink:           viaLink,
+	}
+}
+
+// populateFilesFromDirectory scans the given directory and populates the given map with the files (tagging them with
+// the root, i.e. index of the directory among input directories, and whether it's a reference directory).
+// Directories are walked concurrently, by as many goroutines as parallelism, while files found are same irrespective
+// of that.
+// Ignore files found in directories apply to those directories (and their sub-directories).
+// Directories that are caches or have marker files are skipped entirely (and returned as skippedDirs, sorted).
+// If directories are to be on one file system, those on a device other than that of the directory are skipped
+// (and returned as skippedDirs).
+// If symbolic links are to be followed, files under linked directories are found through the paths of the links
+// (and tagged as such), while directories already visited are skipped when reached through links, so that cyclic
+// links are walked only once.
+func populateFilesFromDirectory(dirPathToScan string, root int, isReference bool, options ScanOptions,
+	parallelism int, allFiles entity.FilePathToMeta) (
+	sizeOfScannedFiles int64,
+	skippedDirs []string,
+	err error,
+) {
+	w := newDirWalker(dirPathToScan, root, isReference, options, parallelism, allFiles)
+	if options.OneFileSystem {
+		info, statErr := os.Stat(dirPathToScan)
+		if statErr != nil {
+			return -1, nil, fmt.Errorf("couldn't scan directory %s: %v", dirPathToScan, statErr)
+		}
+		w.rootDevice, _ = deviceOf(dirPathToScan, info)
 	}
-	return sizeOfScannedFiles, nil
+	w.walk()
+	return w.size, w.skippedDirs, nil
 }
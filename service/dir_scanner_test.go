@@ -0,0 +1,245 @@
+package service
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/ignore"
+	"github.com/stretchr/testify/assert"
+)
+
+// scannedPaths gets paths (relative to the directory, sorted) of files found while scanning the directory
+func scannedPaths(t *testing.T, dir string, options ScanOptions) (paths []string) {
+	allFiles := make(entity.FilePathToMeta)
+	_, _, err := populateFilesFromDirectory(dir, 0, false, options, 4, allFiles)
+	assert.Nil(t, err)
+	for path := range allFiles {
+		rel, _ := filepath.Rel(dir, path)
+		paths = append(paths, filepath.ToSlash(rel))
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestScanWithExclusions(t *testing.T) {
+	fmte.Off()
+	dir := t.TempDir()
+	createFiles(t, dir, map[string]string{
+		"a.txt":                     "a",
+		"x.tmp":                     "x",
+		"sub/cache/y.tmp":           "y",
+		"sub/cache/y.txt":           "y",
+		"projects/p1/build/out.bin": "out",
+		"projects/p1/src/main.go":   "main",
+		"other/projects/p2/build/z": "z",
+	})
+	exclusions := ignore.MustParse("**/cache/*.tmp\n/projects/*/build/\n")
+	assert.Equal(t, []string{
+		"a.txt",
+		"other/projects/p2/build/z",
+		"projects/p1/src/main.go",
+		"sub/cache/y.txt",
+		"x.tmp",
+	}, scannedPaths(t, dir, ScanOptions{Exclusions: exclusions}))
+}
+
+func TestScanWithIgnoreFiles(t *testing.T) {
+	fmte.Off()
+	dir := t.TempDir()
+	createFiles(t, dir, map[string]string{
+		".fdignore":                   "*.log\n",
+		"a.log":                       "a",
+		"team1/.fdignore":             "!keep.log\n/local/\n",
+		"team1/keep.log":              "keep",
+		"team1/other.log":             "other",
+		"team1/local/x.txt":           "x",
+		"team1/sub/local/y.txt":       "y",
+		"team2/local/z.txt":           "z",
+		"code/.gitignore":             "build/\n",
+		"code/build/out.bin":          "out",
+		"code/main.go":                "main",
+		"sibling-of-team1/keep.log":   "not kept, as team1's ignore file doesn't apply here",
+		"sibling-of-team1/report.txt": "report",
+	})
+	expected := []string{
+		".fdignore",
+		"code/.gitignore",
+		"code/main.go",
+		"sibling-of-team1/report.txt",
+		"team1/.fdignore",
+		"team1/keep.log",
+		"team1/sub/local/y.txt",
+		"team2/local/z.txt",
+	}
+	assert.Equal(t, expected, scannedPaths(t, dir, ScanOptions{UseGitignore: true}))
+	withoutGitignore := scannedPaths(t, dir, ScanOptions{})
+	assert.Equal(t, len(expected)+1, len(withoutGitignore))
+	assert.Contains(t, withoutGitignore, "code/build/out.bin")
+}
+
+func TestScanSkipsCacheAndMarkedDirectories(t *testing.T) {
+	fmte.Off()
+	dir := t.TempDir()
+	createFiles(t, dir, map[string]string{
+		"a.txt":                   "a",
+		"thumbnails/CACHEDIR.TAG": cacheDirTagSignature + "\n# This file is a cache directory tag\n",
+		"thumbnails/t.png":        "t",
+		"fake-cache/CACHEDIR.TAG": "no signature here",
+		"fake-cache/f.txt":        "f",
+		"project/.nodedupe":       "",
+		"project/p.txt":           "p",
+	})
+	allFiles := make(entity.FilePathToMeta)
+	_, skippedDirs, err := populateFilesFromDirectory(dir, 0, false, ScanOptions{MarkerFileNames: []string{".nodedupe"}},
+		4, allFiles)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "project"), filepath.Join(dir, "thumbnails")}, skippedDirs)
+	assert.Equal(t, []string{"a.txt", "fake-cache/CACHEDIR.TAG", "fake-cache/f.txt"},
+		scannedPaths(t, dir, ScanOptions{MarkerFileNames: []string{".nodedupe"}}))
+	assert.Equal(t, 5, len(scannedPaths(t, dir, ScanOptions{})))
+}
+
+func TestScanFollowingSymlinks(t *testing.T) {
+	fmte.Off()
+	dir := t.TempDir()
+	createFiles(t, dir, map[string]string{
+		"lib/a.txt":        "a",
+		"outside/b.txt":    "b",
+		"outside/sub/c.md": "c",
+	})
+	for link, target := range map[string]string{
+		"lib/linked":    "../outside", // directory outside the one scanned
+		"lib/loop":      "..",         // cycle
+		"lib/a-link":    "a.txt",      // file
+		"lib/broken":    "missing",    // dangling link
+		"outside/up":    "../lib",     // cycle through the linked directory
+		"outside/c.lnk": "sub/c.md",   // file inside the linked directory
+	} {
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Skipf("symbolic links not supported: %+v", err)
+		}
+	}
+	lib := filepath.Join(dir, "lib")
+	assert.Equal(t, []string{"a.txt"}, scannedPaths(t, lib, ScanOptions{}))
+	assert.Equal(t, []string{"a-link", "a.txt", "linked/b.txt", "linked/c.lnk", "linked/sub/c.md"},
+		scannedPaths(t, lib, ScanOptions{FollowSymlinks: true}))
+	allFiles := make(entity.FilePathToMeta)
+	_, _, err := populateFilesFromDirectory(lib, 0, false, ScanOptions{FollowSymlinks: true}, 4, allFiles)
+	assert.Nil(t, err)
+	assert.False(t, allFiles[filepath.Join(lib, "a.txt")].ViaLink)
+	assert.True(t, allFiles[filepath.Join(lib, "a-link")].ViaLink)
+	assert.True(t, allFiles[filepath.Join(lib, "linked", "sub", "c.md")].ViaLink)
+	assert.Equal(t, map[string][]string{
+		filepath.Join(lib, "a.txt"):           {filepath.Join(lib, "a-link")},
+		filepath.Join(lib, "linked", "c.lnk"): {filepath.Join(lib, "linked", "sub", "c.md")},
+	}, FindHardLinks(allFiles), "paths to the same file should be linked to the one not reached through a link")
+}
+
+func TestScanOnOneFileSystem(t *testing.T) {
+	fmte.Off()
+	dir := t.TempDir()
+	createFiles(t, dir, map[string]string{
+		"a.txt":         "a",
+		"sub/b.txt":     "b",
+		"sub/sub/c.txt": "c",
+	})
+	allFiles := make(entity.FilePathToMeta)
+	_, skippedDirs, err := populateFilesFromDirectory(dir, 0, false, ScanOptions{OneFileSystem: true}, 4,
+		allFiles)
+	assert.Nil(t, err)
+	assert.Empty(t, skippedDirs, "directories on the same file system shouldn't be skipped")
+	assert.Equal(t, 3, len(allFiles))
+	devices := make(map[uint64]struct{})
+	for _, meta := range allFiles {
+		devices[meta.Device] = struct{}{}
+	}
+	assert.Equal(t, 1, len(devices))
+}
+
+func TestScanSkipsOtherFileSystems(t *testing.T) {
+	fmte.Off()
+	dir := t.TempDir()
+	createFiles(t, dir, map[string]string{
+		"a.txt":             "a",
+		"sub/b.txt":         "b",
+		"mnt/c.txt":         "c",
+		"mnt/deeper/d.txt":  "d",
+		"sub/mnt/e.txt":     "e",
+		"sub/not-mnt/f.txt": "f",
+	})
+	mounts := map[string]uint64{filepath.Join(dir, "mnt"): 1, filepath.Join(dir, "sub", "mnt"): 2}
+	defer func(original func(string, fs.FileInfo) (uint64, bool)) { deviceOf = original }(deviceOf)
+	deviceOf = func(path string, _ fs.FileInfo) (uint64, bool) {
+		for mount, device := range mounts {
+			if path == mount || strings.HasPrefix(path, mount+string(filepath.Separator)) {
+				return device, true
+			}
+		}
+		return 0, true
+	}
+	allFiles := make(entity.FilePathToMeta)
+	_, skippedDirs, err := populateFilesFromDirectory(dir, 0, false, ScanOptions{OneFileSystem: true}, 4, allFiles)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "mnt"), filepath.Join(dir, "sub", "mnt")}, skippedDirs)
+	assert.Equal(t, []string{"a.txt", "sub/b.txt", "sub/not-mnt/f.txt"}, scannedPaths(t, dir,
+		ScanOptions{OneFileSystem: true}))
+	assert.Equal(t, []string{"a.txt", "mnt/c.txt", "mnt/deeper/d.txt", "sub/b.txt", "sub/mnt/e.txt",
+		"sub/not-mnt/f.txt"}, scannedPaths(t, dir, ScanOptions{}), "mounts shouldn't be skipped by default")
+}
+
+func TestSummarizeDevices(t *testing.T) {
+	allFiles := entity.FilePathToMeta{
+		"/mnt/b/1.txt": {Size: 10, Device: 7},
+		"/home/a.txt":  {Size: 1, Device: 3},
+		"/mnt/a/2.txt": {Size: 20, Device: 7},
+		"/home/b.txt":  {Size: 2, Device: 3},
+		"/home/c.txt":  {Size: 3, Device: 3},
+	}
+	assert.Equal(t, []deviceSummary{
+		{device: 3, count: 3, size: 6, firstPath: "/home/a.txt"},
+		{device: 7, count: 2, size: 30, firstPath: "/mnt/a/2.txt"},
+	}, summarizeDevices(allFiles))
+}
+
+func TestScanConcurrentlyIsDeterministic(t *testing.T) {
+	fmte.Off()
+	dir := t.TempDir()
+	files := make(map[string]string)
+	for i := 0; i < 20; i++ {
+		for j := 0; j < 5; j++ {
+			files[fmt.Sprintf("d%d/s%d/f.txt", i, j)] = fmt.Sprintf("%d-%d", i, j)
+			files[fmt.Sprintf("d%d/s%d/f.tmp", i, j)] = "excluded"
+		}
+		files[fmt.Sprintf("d%d/.fdignore", i)] = "s0/\n"
+	}
+	files["d7/.nodedupe"] = ""
+	createFiles(t, dir, files)
+	for i := 0; i < 20; i++ {
+		link := filepath.Join(dir, fmt.Sprintf("d%d", i), "next")
+		if err := os.Symlink(fmt.Sprintf("../d%d", (i+1)%20), link); err != nil {
+			t.Skipf("symbolic links not supported: %+v", err)
+		}
+	}
+	options := ScanOptions{Exclusions: ignore.MustParse("*.tmp"), MarkerFileNames: []string{".nodedupe"},
+		FollowSymlinks: true}
+	scan := func(parallelism int) (entity.FilePathToMeta, []string) {
+		allFiles := make(entity.FilePathToMeta)
+		_, skippedDirs, err := populateFilesFromDirectory(dir, 0, false, options, parallelism, allFiles)
+		assert.Nil(t, err)
+		return allFiles, skippedDirs
+	}
+	expectedFiles, expectedSkippedDirs := scan(1)
+	assert.Equal(t, 19*4+19, len(expectedFiles)) // directories reached through links have all been visited already
+	for i := 0; i < 5; i++ {
+		actualFiles, actualSkippedDirs := scan(8)
+		assert.Equal(t, expectedFiles, actualFiles)
+		assert.Equal(t, expectedSkippedDirs, actualSkippedDirs)
+	}
+}
@@ -0,0 +1,247 @@
+package service
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/utils"
+)
+
+// dirToWalk is a directory to be walked, along with the ignore files that apply to it
+type dirToWalk struct {
+	path    string          // path of the directory, as found (i.e. possibly through symbolic links)
+	viaLink bool            // whether the directory was reached through a symbolic link
+	scoped  []scopedMatcher // matchers of ignore files in directories above it, outermost first
+}
+
+// dirWalker walks a directory, with multiple goroutines walking its sub-directories concurrently. Files found are
+// added to allFiles, which is guarded by a mutex (as are other results of the walk).
+// Links to directories (if symbolic links are followed) aren't walked along with other directories: they're walked
+// later, one at a time and in order of their paths, so that which of the paths through which a directory can be
+// reached is used doesn't depend on how goroutines are scheduled.
+type dirWalker struct {
+	dirPathToScan string
+	root          int
+	isReference   bool
+	options       ScanOptions
+	parallelism   int
+	rootDevice    uint64              // device of the directory being scanned (only if options.OneFileSystem)
+	visitedDirs   map[fileID]struct{} // directories walked so far (only if options.FollowSymlinks)
+
+	mx          sync.Mutex
+	cond        *sync.Cond
+	pending     []dirToWalk // directories yet to be walked
+	numActive   int         // number of directories pending or being walked
+	allFiles    entity.FilePathToMeta
+	size        int64
+	skippedDirs []string
+	dirLinks    []dirToWalk // links to directories, to be walked after the directories being walked now
+	walkedDirs  []fileID    // directories walked since visitedDirs was last updated
+}
+
+// newDirWalker creates a walker that adds files found to allFiles
+func newDirWalker(dirPathToScan string, root int, isReference bool, options ScanOptions, parallelism int,
+	allFiles entity.FilePathToMeta,
+) *dirWalker {
+	w := &dirWalker{
+		dirPathToScan: dirPathToScan,
+		root:          root,
+		isReference:   isReference,
+		options:       options,
+		parallelism:   max(parallelism, 1),
+		visitedDirs:   make(map[fileID]struct{}),
+		allFiles:      allFiles,
+	}
+	w.cond = sync.NewCond(&w.mx)
+	return w
+}
+
+// walk walks the directory being scanned, and then links to directories found under it (and links found under those,
+// and so on)
+func (w *dirWalker) walk() {
+	w.enter(dirToWalk{path: w.dirPathToScan}, func() (fs.FileInfo, error) {
+		return os.Stat(w.dirPathToScan)
+	})
+	w.run()
+	for len(w.dirLinks) > 0 {
+		dirLinks := w.dirLinks
+		w.dirLinks = nil
+		sort.Slice(dirLinks, func(i, j int) bool {
+			return dirLinks[i].path < dirLinks[j].path
+		})
+		for _, link := range dirLinks {
+			w.enter(link, func() (fs.FileInfo, error) {
+				return os.Stat(link.path)
+			})
+			w.run()
+		}
+	}
+	sort.Strings(w.skippedDirs)
+}
+
+// run walks directories pending (and their sub-directories) using a pool of goroutines, until none are left
+func (w *dirWalker) run() {
+	var wg sync.WaitGroup
+	for i := 0; i < w.parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				dir, exists := w.next()
+				if !exists {
+					return
+				}
+				w.walkDir(dir)
+				w.done()
+			}
+		}()
+	}
+	wg.Wait()
+	for _, id := range w.walkedDirs {
+		w.visitedDirs[id] = struct{}{}
+	}
+	w.walkedDirs = nil
+}
+
+// next waits for a directory to be walked. It returns false once no directories are pending or being walked.
+func (w *dirWalker) next() (dir dirToWalk, exists bool) {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	for len(w.pending) == 0 && w.numActive > 0 {
+		w.cond.Wait()
+	}
+	if len(w.pending) == 0 {
+		return dir, false
+	}
+	dir = w.pending[len(w.pending)-1]
+	w.pending = w.pending[:len(w.pending)-1]
+	return dir, true
+}
+
+// done marks a directory as walked
+func (w *dirWalker) done() {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	w.numActive--
+	if w.numActive == 0 {
+		w.cond.Broadcast()
+	}
+}
+
+// enter queues the directory to be walked, unless it's to be skipped entirely (infoOf gets its metadata)
+func (w *dirWalker) enter(dir dirToWalk, infoOf func() (fs.FileInfo, error)) {
+	if w.options.isPruned(dir.path) {
+		w.skip(dir.path)
+		return
+	}
+	if w.options.OneFileSystem || w.options.FollowSymlinks {
+		info, infoErr := infoOf()
+		if infoErr != nil {
+			fmte.PrintfErr("skipping \"%s\": %+v\n", dir.path, infoErr)
+			return
+		}
+		if w.options.OneFileSystem {
+			if device, ok := deviceOf(dir.path, info); ok && device != w.rootDevice {
+				w.skip(dir.path)
+				return
+			}
+		}
+		device, inode, ok := utils.GetFileID(info)
+		if w.options.FollowSymlinks {
+			if !ok && dir.viaLink {
+				fmte.PrintfErr("skipping \"%s\": can't follow links to directories on this platform\n", dir.path)
+				return
+			}
+			// Directories reached through links may have been visited already (e.g. via a link to an ancestor)
+			if _, visited := w.visitedDirs[fileID{device, inode}]; visited && dir.viaLink {
+				return
+			}
+			w.mx.Lock()
+			w.walkedDirs = append(w.walkedDirs, fileID{device, inode})
+			w.mx.Unlock()
+		}
+	}
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	w.pending = append(w.pending, dir)
+	w.numActive++
+	w.cond.Signal()
+}
+
+// skip records the directory as skipped entirely
+func (w *dirWalker) skip(path string) {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	w.skippedDirs = append(w.skippedDirs, path)
+}
+
+// walkDir walks entries of the directory (queueing its sub-directories to be walked)
+func (w *dirWalker) walkDir(dir dirToWalk) {
+	scoped := append(slices.Clip(dir.scoped), w.options.readIgnoreFiles(dir.path)...)
+	entries, readErr := os.ReadDir(dir.path)
+	if readErr != nil {
+		fmte.PrintfErr("skipping \"%s\": %+v\n", dir.path, errors.Unwrap(readErr))
+	}
+	for _, d := range entries {
+		w.visit(filepath.Join(dir.path, d.Name()), d, dir.viaLink, scoped)
+	}
+}
+
+// visit handles an entry of a directory being walked
+func (w *dirWalker) visit(path string, d fs.DirEntry, viaLink bool, scoped []scopedMatcher) {
+	isDir, isLink := d.IsDir(), d.Type()&fs.ModeSymlink != 0
+	var linkedInfo fs.FileInfo // metadata of the file/directory the link points to
+	if isLink && w.options.FollowSymlinks {
+		var statErr error
+		if linkedInfo, statErr = os.Stat(path); statErr != nil {
+			fmte.PrintfErr("skipping \"%s\": %+v\n", path, errors.Unwrap(statErr))
+			return
+		}
+		isDir = linkedInfo.IsDir()
+	}
+	// If the file/directory matches exclusion patterns, ignore it
+	if w.options.isExcluded(w.dirPathToScan, path, isDir, scoped) {
+		return
+	}
+	if isDir {
+		dir := dirToWalk{path: path, viaLink: viaLink || linkedInfo != nil, scoped: scoped}
+		if linkedInfo != nil {
+			w.mx.Lock()
+			w.dirLinks = append(w.dirLinks, dir)
+			w.mx.Unlock()
+		} else {
+			w.enter(dir, d.Info)
+		}
+		return
+	}
+	// Ignore dot allFiles (Mac)
+	if strings.HasPrefix(d.Name(), "._") {
+		return
+	}
+	info := linkedInfo
+	if info == nil && d.Type().IsRegular() {
+		var infoErr error
+		if info, infoErr = d.Info(); infoErr != nil {
+			fmte.PrintfErr("couldn't get metadata of \"%s\": %+v\n", path, infoErr)
+			return
+		}
+	}
+	if info == nil || !info.Mode().IsRegular() || info.Size() < w.options.FileSizeThreshold {
+		return
+	}
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	if _, exists := w.allFiles[path]; exists {
+		return
+	}
+	w.allFiles[path] = newFileMeta(info, w.root, w.isReference, viaLink || linkedInfo != nil)
+	w.size += info.Size()
+}
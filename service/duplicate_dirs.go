@@ -0,0 +1,243 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/fmte"
+)
+
+// dirNode is a directory, as seen through the files found under it
+type dirNode struct {
+	files    []dirFile           // files directly in this directory
+	subdirs  map[string]struct{} // names of sub-directories that have files found under them
+	isUnique bool                // whether some file under this directory has no duplicate
+	size     int64               // total size of files under this directory
+	hash     string              // hash of this directory (computed from hashes of its children)
+	contents []string            // hashes of all files under this directory (only for entity.DirectoryModeContents)
+}
+
+// dirFile is a file in a directory, along with the hash of its contents
+type dirFile struct {
+	name string
+	size int64
+	hash string
+}
+
+// FindDuplicateDirectories finds directories with identical contents, using duplicates found by FindDuplicates.
+// Every directory is hashed from its children, Merkle-style: with mode entity.DirectoryModeTree, from names and
+// hashes of its files and sub-directories, while with mode entity.DirectoryModeContents, from contents of all files
+// under it (regardless of their names and layout). Only files found while scanning count (i.e. files excluded or
+// smaller than the minimum size are disregarded).
+// Returned groups has groups of directories (paths ending with a path separator) and groups of files from duplicates,
+// except those groups of which every member is inside a directory found to have duplicates. Duplicates counted
+// exclude files and directories inside directories that are themselves counted as duplicates.
+func FindDuplicateDirectories(duplicates *entity.DigestToFiles, allFiles entity.FilePathToMeta, directories []string,
+	mode string) (
+	groups *entity.DigestToFiles, duplicateTotalCount int64, savingsSize int64,
+) {
+	fmte.Printf("Finding duplicate directories...\n")
+	fileHashes := make(map[string]string, len(allFiles))
+	links := FindHardLinks(allFiles)
+	for iter := duplicates.Iterator(); iter.HasNext(); {
+		digest, paths := iter.Next()
+		for _, path := range paths {
+			h := fmt.Sprintf("%d/%s", digest.FileSize, digest.FileHash)
+			fileHashes[path] = h
+			for _, linkedPath := range links[path] {
+				fileHashes[linkedPath] = h
+			}
+		}
+	}
+	nodes := buildDirTree(allFiles, directories, fileHashes)
+	dirs := make([]string, 0, len(nodes))
+	for dir := range nodes {
+		dirs = append(dirs, dir)
+	}
+	// Sub-directories have longer paths than their parents, so this ensures children are hashed before parents
+	sort.Slice(dirs, func(i, j int) bool {
+		if len(dirs[i]) != len(dirs[j]) {
+			return len(dirs[i]) > len(dirs[j])
+		}
+		return dirs[i] < dirs[j]
+	})
+	hashToDirs := make(map[string][]string)
+	var hashOrder []string
+	for _, dir := range dirs {
+		node := nodes[dir]
+		node.computeHash(dir, nodes, mode)
+		if node.isUnique {
+			continue
+		}
+		// A directory with nothing but a sub-directory has exactly the contents of that sub-directory
+		if mode == entity.DirectoryModeContents && len(node.files) == 0 && len(node.subdirs) == 1 {
+			continue
+		}
+		if _, exists := hashToDirs[node.hash]; !exists {
+			hashOrder = append(hashOrder, node.hash)
+		}
+		hashToDirs[node.hash] = append(hashToDirs[node.hash], dir)
+	}
+	matchedDirs := make(map[string]struct{})
+	for _, h := range hashOrder {
+		if len(hashToDirs[h]) > 1 {
+			for _, dir := range hashToDirs[h] {
+				matchedDirs[dir] = struct{}{}
+			}
+		}
+	}
+	isRedundant := func(paths []string) bool {
+		for _, path := range paths {
+			if _, matched := matchedDirs[filepath.Dir(path)]; !matched {
+				return false
+			}
+		}
+		return true
+	}
+	groups = entity.NewDigestToFiles()
+	for _, h := range hashOrder {
+		matching := hashToDirs[h]
+		if len(matching) <= 1 || isRedundant(matching) {
+			continue
+		}
+		sort.Strings(matching)
+		digest := entity.FileDigest{FileSize: nodes[matching[0]].size, FileHash: h, IsDirectory: true}
+		for _, dir := range matching {
+			groups.Set(digest, dir+string(filepath.Separator))
+		}
+	}
+	for iter := duplicates.Iterator(); iter.HasNext(); {
+		digest, paths := iter.Next()
+		if isRedundant(paths) {
+			continue
+		}
+		for _, path := range paths {
+			groups.Set(*digest, path)
+		}
+	}
+	duplicateTotalCount, savingsSize = countDuplicates(withoutRemovableContents(groups), allFiles)
+	return groups, duplicateTotalCount, savingsSize
+}
+
+// withoutRemovableContents gets the groups, excluding paths under directories that would be removed (i.e. all but
+// the first directory, in sorted order, in every group of directories), so that contents of such directories aren't
+// counted again
+func withoutRemovableContents(groups *entity.DigestToFiles) *entity.DigestToFiles {
+	removableDirs := make(map[string]struct{})
+	for iter := groups.Iterator(); iter.HasNext(); {
+		_, paths := iter.Next()
+		if !strings.HasSuffix(paths[0], string(filepath.Separator)) {
+			continue
+		}
+		kept := slices.Min(paths)
+		for _, path := range paths {
+			if path != kept {
+				removableDirs[strings.TrimSuffix(path, string(filepath.Separator))] = struct{}{}
+			}
+		}
+	}
+	isUnderRemovableDir := func(path string) bool {
+		path = strings.TrimSuffix(path, string(filepath.Separator))
+		for dir := filepath.Dir(path); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+			if _, removable := removableDirs[dir]; removable {
+				return true
+			}
+		}
+		return false
+	}
+	remaining := entity.NewDigestToFiles()
+	for iter := groups.Iterator(); iter.HasNext(); {
+		digest, paths := iter.Next()
+		for _, path := range paths {
+			if !isUnderRemovableDir(path) {
+				remaining.Set(*digest, path)
+			}
+		}
+	}
+	return remaining
+}
+
+// buildDirTree creates nodes for all directories that have files under them, up to the input directories
+func buildDirTree(allFiles entity.FilePathToMeta, directories []string, fileHashes map[string]string,
+) map[string]*dirNode {
+	nodes := make(map[string]*dirNode)
+	nodeOf := func(dir string) *dirNode {
+		node, exists := nodes[dir]
+		if !exists {
+			node = &dirNode{subdirs: make(map[string]struct{})}
+			nodes[dir] = node
+		}
+		return node
+	}
+	for path, meta := range allFiles {
+		root := outermostRootOf(path, directories)
+		if root == "" {
+			continue
+		}
+		dir := filepath.Dir(path)
+		node := nodeOf(dir)
+		if h, exists := fileHashes[path]; exists {
+			node.files = append(node.files, dirFile{name: filepath.Base(path), size: meta.Size, hash: h})
+		} else {
+			node.isUnique = true
+		}
+		for ; dir != root && len(dir) > len(root); dir = filepath.Dir(dir) {
+			nodeOf(filepath.Dir(dir)).subdirs[filepath.Base(dir)] = struct{}{}
+		}
+	}
+	return nodes
+}
+
+// computeHash computes the hash of the directory from its children (which should have been computed already)
+func (node *dirNode) computeHash(dir string, nodes map[string]*dirNode, mode string) {
+	var lines []string
+	for _, file := range node.files {
+		node.size += file.size
+		if mode == entity.DirectoryModeContents {
+			node.contents = append(node.contents, file.hash)
+		} else {
+			lines = append(lines, fmt.Sprintf("f %q %s", file.name, file.hash))
+		}
+	}
+	for name := range node.subdirs {
+		subdir := nodes[filepath.Join(dir, name)]
+		node.isUnique = node.isUnique || subdir.isUnique
+		node.size += subdir.size
+		if mode == entity.DirectoryModeContents {
+			node.contents = append(node.contents, subdir.contents...)
+			subdir.contents = nil // not needed anymore
+		} else {
+			lines = append(lines, fmt.Sprintf("d %q %s", name, subdir.hash))
+		}
+	}
+	if node.isUnique {
+		node.contents = nil
+		return
+	}
+	if mode == entity.DirectoryModeContents {
+		lines = append(lines, node.contents...)
+	}
+	sort.Strings(lines)
+	h := sha256.New()
+	for _, line := range lines {
+		_, _ = h.Write([]byte(line + "\n"))
+	}
+	node.hash = "d" + hex.EncodeToString(h.Sum(nil))
+}
+
+// outermostRootOf gets the outermost of the input directories under which the path is
+func outermostRootOf(path string, directories []string) (root string) {
+	for _, dir := range directories {
+		prefix := strings.TrimSuffix(dir, string(filepath.Separator)) + string(filepath.Separator)
+		if strings.HasPrefix(path, prefix) && (root == "" || len(dir) < len(root)) {
+			root = dir
+		}
+	}
+	return root
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/stretchr/testify/assert"
+)
+
+// createFiles creates files with given contents under the directory
+func createFiles(t *testing.T, dir string, pathToContents map[string]string) {
+	for path, contents := range pathToContents {
+		fullPath := filepath.Join(dir, path)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(fullPath), 0o755))
+		assert.Nil(t, os.WriteFile(fullPath, []byte(contents), 0o644))
+	}
+}
+
+// groupsOf gets groups of paths (relative to the directory, sorted) in duplicates
+func groupsOf(dir string, duplicates *entity.DigestToFiles) (groups [][]string) {
+	for iter := duplicates.Iterator(); iter.HasNext(); {
+		_, paths := iter.Next()
+		var group []string
+		for _, path := range paths {
+			rel, _ := filepath.Rel(dir, path)
+			if path[len(path)-1] == filepath.Separator {
+				rel += string(filepath.Separator)
+			}
+			group = append(group, rel)
+		}
+		sort.Strings(group)
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i][0] < groups[j][0]
+	})
+	return groups
+}
+
+func TestFindDuplicateDirectories(t *testing.T) {
+	fmte.Off()
+	dir := t.TempDir()
+	createFiles(t, dir, map[string]string{
+		"a/one.txt":          "first file",
+		"a/sub/two.txt":      "second file",
+		"a/sub/deep/3.txt":   "third file",
+		"b/one.txt":          "first file",
+		"b/sub/two.txt":      "second file",
+		"b/sub/deep/3.txt":   "third file",
+		"c/1.txt":            "first file",
+		"c/2.txt":            "second file",
+		"c/only/3.txt":       "third file",
+		"d/one.txt":          "first file",
+		"d/unique.txt":       "unique file",
+		"d/lone/shared.txt":  "shared file",
+		"e/lone/shared.txt":  "shared file",
+		"e/sub/two-copy.txt": "second file",
+	})
+	sep := string(filepath.Separator)
+	// Contents of directories other than the first in their groups aren't counted again as duplicates
+	expectedCounts := map[string]int64{entity.DirectoryModeTree: 7, entity.DirectoryModeContents: 5}
+	for mode, expected := range map[string][][]string{
+		entity.DirectoryModeTree: {
+			{"a" + sep, "b" + sep},
+			{"a/one.txt", "b/one.txt", "c/1.txt", "d/one.txt"},
+			{"a/sub/deep" + sep, "b/sub/deep" + sep, "c/only" + sep},
+			{"a/sub/two.txt", "b/sub/two.txt", "c/2.txt", "e/sub/two-copy.txt"},
+			{"d/lone" + sep, "e/lone" + sep},
+		},
+		entity.DirectoryModeContents: {
+			{"a" + sep, "b" + sep, "c" + sep},
+			{"a/one.txt", "b/one.txt", "c/1.txt", "d/one.txt"},
+			{"a/sub/two.txt", "b/sub/two.txt", "c/2.txt", "e/sub/two-copy.txt"},
+			{"d/lone" + sep, "e/lone" + sep},
+		},
+	} {
+		duplicates, _, _, allFiles, err := FindDuplicates([]string{dir}, set.NewSet[string](), ScanOptions{}, 2, nil, 0)
+		assert.Nil(t, err)
+		groups, count, _ := FindDuplicateDirectories(duplicates, allFiles, []string{dir}, mode)
+		assert.Equal(t, expected, groupsOf(dir, groups), mode)
+		assert.Equal(t, expectedCounts[mode], count, mode)
+		for iter := groups.Iterator(); iter.HasNext(); {
+			digest, paths := iter.Next()
+			assert.Equal(t, paths[0][len(paths[0])-1] == filepath.Separator, digest.IsDirectory, paths)
+		}
+	}
+}
+
+func TestFindDuplicateDirectoriesSavings(t *testing.T) {
+	fmte.Off()
+	dir := t.TempDir()
+	createFiles(t, dir, map[string]string{
+		"a/one.txt":    "first file",
+		"a/two.txt":    "second file",
+		"b/one.txt":    "first file",
+		"b/two.txt":    "second file",
+		"c/1.txt":      "first file",
+		"c/2.txt":      "second file",
+		"d/one.txt":    "first file",
+		"d/unique.txt": "unique file",
+	})
+	duplicates, _, _, allFiles, err := FindDuplicates([]string{dir}, set.NewSet[string](), ScanOptions{}, 2, nil, 0)
+	assert.Nil(t, err)
+	groups, count, savingsSize := FindDuplicateDirectories(duplicates, allFiles, []string{dir},
+		entity.DirectoryModeContents)
+	sep := string(filepath.Separator)
+	assert.Equal(t, [][]string{
+		{"a" + sep, "b" + sep, "c" + sep},
+		{"a/one.txt", "b/one.txt", "c/1.txt", "d/one.txt"},
+	}, groupsOf(dir, groups))
+	// b/ and c/ can be removed, along with d/one.txt (copies of which in b/ and c/ are removed along with them)
+	assert.Equal(t, int64(3), count)
+	assert.Equal(t, int64(2*len("first file"+"second file")+len("first file")), savingsSize)
+}
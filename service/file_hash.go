@@ -9,20 +9,52 @@ import (
 	"github.com/m-manu/go-find-duplicates/utils"
 	"hash"
 	"hash/crc32"
+	"io"
 	"os"
 )
 
 const (
 	thresholdFileSize = 16 * bytesutil.KIBI
+	prefixSize        = 4 * bytesutil.KIBI
+	readBufferSize    = 1 * bytesutil.MEBI
 )
 
-// GetDigest generates entity.FileDigest of the file provided
-func GetDigest(path string, isThorough bool) (entity.FileDigest, error) {
+// hashStage is a step of the progressive hashing pipeline. Every stage costs more I/O than the one before it,
+// so only files that still collide after a stage are escalated to the next one.
+type hashStage int
+
+// Stages of the hashing pipeline, cheapest first
+const (
+	stagePrefix  hashStage = iota // CRC32 of the first few bytes of the file
+	stageCrucial                  // CRC32 of "crucial bytes" of the file
+	stageFull                     // SHA-256 of entire file contents
+)
+
+// String returns a human-readable description of the stage
+func (s hashStage) String() string {
+	switch s {
+	case stagePrefix:
+		return "first few bytes"
+	case stageCrucial:
+		return "crucial bytes"
+	case stageFull:
+		return "entire contents"
+	default:
+		return fmt.Sprintf("stage %d", int(s))
+	}
+}
+
+// hashStages are the stages applied, in order. The last stage determines entity.FileDigest.FileHash.
+var hashStages = []hashStage{stagePrefix, stageCrucial, stageFull}
+
+// GetDigest generates entity.FileDigest of the file provided (with SHA-256 of its entire contents as the hash).
+// Hash is reused from the cache (which may be nil), if the file hasn't changed since it was cached.
+func GetDigest(path string, cache *HashCache) (entity.FileDigest, error) {
 	info, statErr := os.Lstat(path)
 	if statErr != nil {
 		return entity.FileDigest{}, statErr
 	}
-	h, hashErr := fileHash(path, isThorough)
+	h, hashErr := fileHash(path, false, stageFull, cache, nil)
 	if hashErr != nil {
 		return entity.FileDigest{}, hashErr
 	}
@@ -33,68 +65,127 @@ func GetDigest(path string, isThorough bool) (entity.FileDigest, error) {
 	}, nil
 }
 
-// fileHash calculates the hash of the file provided.
-// If isThorough is true, then it uses SHA256 of the entire file.
-// Otherwise, it uses CRC32 of "crucial bytes" of the file.
-func fileHash(path string, isThorough bool) (string, error) {
-	fileInfo, statErr := os.Lstat(path)
+// fileHash calculates the hash of the file provided for the given stage:
+// stagePrefix uses CRC32 of first few bytes of the file,
+// stageCrucial uses CRC32 of "crucial bytes" of the file and
+// stageFull uses SHA256 of the entire file (read in chunks, so memory used doesn't depend on file size).
+// If the path is a symbolic link, the file it points to is hashed only if viaLink is set (i.e. the path was reached
+// through links that were followed while scanning).
+// Hash is reused from the cache (which may be nil), if the file hasn't changed since it was cached.
+// Memory used for reading the file is reserved from the budget (which may be nil).
+func fileHash(path string, viaLink bool, stage hashStage, cache *HashCache, budget *memoryBudget) (string, error) {
+	stat := os.Lstat
+	if viaLink {
+		stat = os.Stat
+	}
+	fileInfo, statErr := stat(path)
 	if statErr != nil {
 		return "", fmt.Errorf("couldn't stat: %+v", statErr)
 	}
 	if !fileInfo.Mode().IsRegular() {
 		return "", fmt.Errorf("can't compute hash of non-regular file")
 	}
+	if h, cached := cache.lookup(path, viaLink, fileInfo, stage); cached {
+		return h, nil
+	}
+	// All reads go through a buffer of the size reserved (which may be less than what's read, if budget is tight)
+	reserved := budget.acquire(readSizeOf(stage, fileInfo.Size()))
+	defer budget.release(reserved)
+	buffer := make([]byte, max(reserved, 1))
+	var h hash.Hash
+	if stage == stageFull {
+		h = sha256.New()
+	} else {
+		h = crc32.NewIEEE()
+	}
 	var prefix string
-	var bytes []byte
 	var fileReadErr error
-	if isThorough {
-		bytes, fileReadErr = os.ReadFile(path)
-	} else if fileInfo.Size() <= thresholdFileSize {
+	switch size := fileInfo.Size(); {
+	case stage == stageFull:
+		fileReadErr = readInChunks(path, h, buffer)
+	case stage == stagePrefix:
+		prefix = "p"
+		fileReadErr = readRanges(path, h, buffer, byteRange{0, min(size, prefixSize)})
+	case size <= thresholdFileSize:
 		prefix = "f"
-		bytes, fileReadErr = os.ReadFile(path)
-	} else {
+		fileReadErr = readRanges(path, h, buffer, byteRange{0, size})
+	default:
+		// "crucial bytes" are the first few bytes, middle bytes and last few bytes of the file
 		prefix = "s"
-		bytes, fileReadErr = readCrucialBytes(path, fileInfo.Size())
+		fileReadErr = readRanges(path, h, buffer,
+			byteRange{0, thresholdFileSize / 2},
+			byteRange{size / 2, thresholdFileSize / 4},
+			byteRange{size - thresholdFileSize/4, thresholdFileSize / 4},
+		)
 	}
 	if fileReadErr != nil {
 		return "", fmt.Errorf("couldn't calculate hash: %+v", fileReadErr)
 	}
-	var h hash.Hash
-	if isThorough {
-		h = sha256.New()
-	} else {
-		h = crc32.NewIEEE()
-	}
-	_, hashErr := h.Write(bytes)
-	if hashErr != nil {
-		return "", fmt.Errorf("error while computing hash: %+v", hashErr)
-	}
 	hashBytes := h.Sum(nil)
-	return prefix + hex.EncodeToString(hashBytes), nil
+	hashStr := prefix + hex.EncodeToString(hashBytes)
+	cache.store(path, viaLink, fileInfo, stage, hashStr)
+	return hashStr, nil
+}
+
+// readSizeOf returns the number of bytes held in memory at once while hashing a file for the given stage
+func readSizeOf(stage hashStage, fileSize int64) int64 {
+	switch stage {
+	case stagePrefix:
+		return min(fileSize, prefixSize)
+	case stageCrucial:
+		return min(fileSize, thresholdFileSize)
+	default:
+		return max(min(fileSize, readBufferSize), 1)
+	}
 }
 
-// readCrucialBytes reads the first few bytes, middle bytes and last few bytes of the file
-func readCrucialBytes(filePath string, fileSize int64) ([]byte, error) {
+// readInChunks reads the entire file, chunk by chunk (each of which fits in the buffer), into the writer
+func readInChunks(filePath string, w io.Writer, buffer []byte) error {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer file.Close()
-	firstBytes := make([]byte, thresholdFileSize/2)
-	_, fErr := file.ReadAt(firstBytes, 0)
-	if fErr != nil {
-		return nil, fmt.Errorf("couldn't read first few bytes (maybe file is corrupted?): %+v", fErr)
+	for {
+		n, rErr := file.Read(buffer)
+		if n > 0 {
+			if _, wErr := w.Write(buffer[:n]); wErr != nil {
+				return wErr
+			}
+		}
+		if rErr == io.EOF {
+			return nil
+		} else if rErr != nil {
+			return rErr
+		}
 	}
-	middleBytes := make([]byte, thresholdFileSize/4)
-	_, mErr := file.ReadAt(middleBytes, fileSize/2)
-	if mErr != nil {
-		return nil, fmt.Errorf("couldn't read middle bytes (maybe file is corrupted?): %+v", mErr)
+}
+
+// byteRange is a range of bytes of a file
+type byteRange struct {
+	offset int64
+	length int64
+}
+
+// readRanges reads the ranges of bytes of the file, chunk by chunk (each of which fits in the buffer), into the writer
+func readRanges(filePath string, w io.Writer, buffer []byte, ranges ...byteRange) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
 	}
-	lastBytes := make([]byte, thresholdFileSize/4)
-	_, lErr := file.ReadAt(lastBytes, fileSize-thresholdFileSize/4)
-	if lErr != nil {
-		return nil, fmt.Errorf("couldn't read end bytes (maybe file is corrupted?): %+v", lErr)
+	defer file.Close()
+	for _, r := range ranges {
+		for done := int64(0); done < r.length; {
+			chunk := buffer[:min(int64(len(buffer)), r.length-done)]
+			if _, rErr := file.ReadAt(chunk, r.offset+done); rErr != nil {
+				return fmt.Errorf("couldn't read %d bytes at offset %d (maybe file is corrupted?): %+v", len(chunk),
+					r.offset+done, rErr)
+			}
+			if _, wErr := w.Write(chunk); wErr != nil {
+				return wErr
+			}
+			done += int64(len(chunk))
+		}
 	}
-	bytes := append(append(firstBytes, middleBytes...), lastBytes...)
-	return bytes, nil
+	return nil
 }
@@ -19,17 +19,35 @@ func TestGetDigest(t *testing.T) {
 		filepath.Join(goRoot, "/src/io/pipe.go"),
 	}
 	for _, path := range paths {
-		digest, err := GetDigest(path, false)
-		assert.Equal(t, nil, err)
-		assert.Greater(t, digest.FileSize, int64(0))
-		assert.Equal(t, 9, len(digest.FileHash))
-		assert.Greater(t, len(digest.FileExtension), 0)
-	}
-	for _, path := range paths {
-		digest, err := GetDigest(path, true)
+		digest, err := GetDigest(path, nil)
 		assert.Equal(t, nil, err)
 		assert.Greater(t, digest.FileSize, int64(0))
 		assert.Equal(t, 64, len(digest.FileHash))
 		assert.Greater(t, len(digest.FileExtension), 0)
 	}
 }
+
+func TestFileHashStages(t *testing.T) {
+	path := filepath.Join(runtime.GOROOT(), "/src/io/io.go")
+	digest, err := GetDigest(path, nil)
+	assert.Nil(t, err)
+	finalHash, err := fileHash(path, false, hashStages[len(hashStages)-1], nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, digest.FileHash, finalHash)
+	prefixHash, err := fileHash(path, false, stagePrefix, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 9, len(prefixHash))
+	assert.Equal(t, []hashStage{stagePrefix, stageCrucial, stageFull}, hashStages)
+}
+
+func TestFileHashWithinBudget(t *testing.T) {
+	path := filepath.Join(runtime.GOROOT(), "/src/io/io.go") // larger than thresholdFileSize
+	for _, stage := range hashStages {
+		expected, err := fileHash(path, false, stage, nil, nil)
+		assert.Nil(t, err)
+		// Budget smaller than any sample read: hash should be same, as it's computed reading small chunks at a time
+		actual, err := fileHash(path, false, stage, nil, newMemoryBudget(100))
+		assert.Nil(t, err)
+		assert.Equal(t, expected, actual, stage.String())
+	}
+}
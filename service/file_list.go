@@ -0,0 +1,88 @@
+package service
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/fmte"
+)
+
+// ReadFileList reads a list of paths, one per line (or separated by NUL characters, as output by `find -print0`).
+// Empty entries are ignored.
+func ReadFileList(r io.Reader, isNulSeparated bool) (paths []string, err error) {
+	separator := byte('\n')
+	if isNulSeparated {
+		separator = 0
+	}
+	br := bufio.NewReader(r)
+	for {
+		entry, readErr := br.ReadString(separator)
+		entry = strings.TrimSuffix(entry, string(separator))
+		if !isNulSeparated {
+			entry = strings.TrimSuffix(entry, "\r")
+		}
+		if entry != "" {
+			paths = append(paths, entry)
+		}
+		if readErr == io.EOF {
+			return paths, nil
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+}
+
+// isListedFileExcluded checks whether the file, or any directory above it, is excluded. Exclusions are matched against
+// the path as listed (so patterns anchored with a "/" are relative to the directory the paths are relative to).
+func (options ScanOptions) isListedFileExcluded(path string) bool {
+	segments := strings.Split(strings.Trim(filepath.ToSlash(filepath.Clean(path)), "/"), "/")
+	for i := 1; i < len(segments); i++ {
+		if options.Exclusions.Match(strings.Join(segments[:i], "/"), true) {
+			return true
+		}
+	}
+	return options.Exclusions.Match(strings.Join(segments, "/"), false)
+}
+
+// populateFilesFromList populates the given map with the files listed (with their absolute paths), just as
+// populateFilesFromDirectory does with files found in a directory
+func populateFilesFromList(paths []string, options ScanOptions, allFiles entity.FilePathToMeta,
+) (sizeOfScannedFiles int64) {
+	for _, path := range paths {
+		if options.isListedFileExcluded(path) {
+			continue
+		}
+		absPath, absErr := filepath.Abs(path)
+		if absErr != nil {
+			fmte.PrintfErr("skipping \"%s\": %+v\n", path, absErr)
+			continue
+		}
+		info, statErr := os.Lstat(absPath)
+		isLink := statErr == nil && info.Mode()&fs.ModeSymlink != 0
+		if isLink && options.FollowSymlinks {
+			info, statErr = os.Stat(absPath)
+		}
+		if statErr != nil {
+			fmte.PrintfErr("skipping \"%s\": %+v\n", path, errors.Unwrap(statErr))
+			continue
+		}
+		// As while scanning directories, directories and other non-regular files are ignored, as are dot files (Mac)
+		if !info.Mode().IsRegular() || strings.HasPrefix(filepath.Base(absPath), "._") ||
+			info.Size() < options.FileSizeThreshold {
+			continue
+		}
+		if _, exists := allFiles[absPath]; exists {
+			continue
+		}
+		allFiles[absPath] = newFileMeta(info, 0, false, isLink)
+		sizeOfScannedFiles += info.Size()
+	}
+	return sizeOfScannedFiles
+}
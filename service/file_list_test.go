@@ -0,0 +1,49 @@
+package service
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/ignore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadFileList(t *testing.T) {
+	paths, err := ReadFileList(strings.NewReader("a.txt\r\n\nsub dir/b.txt\nc.txt"), false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a.txt", "sub dir/b.txt", "c.txt"}, paths)
+	paths, err = ReadFileList(strings.NewReader("a.txt\x00with\nnewline.txt\x00\x00"), true)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a.txt", "with\nnewline.txt"}, paths)
+}
+
+func TestFindDuplicatesOfFiles(t *testing.T) {
+	fmte.Off()
+	dir := t.TempDir()
+	createFiles(t, dir, map[string]string{
+		"a.txt":           "listed thrice",
+		"copy/a.txt":      "listed thrice",
+		"vendor/a.txt":    "listed thrice",
+		"unlisted/a.txt":  "listed thrice",
+		"b.txt":           "small",
+		"copy/b.txt":      "small",
+		"c.txt":           "not duplicated",
+		"excluded/c.txt":  "not duplicated",
+		"excluded/c2.txt": "not duplicated",
+	})
+	var paths []string
+	for _, path := range []string{"a.txt", "copy/a.txt", "vendor/a.txt", "b.txt", "copy/b.txt", "c.txt",
+		"excluded/c.txt", "excluded/c2.txt", "copy", "missing.txt", "a.txt"} {
+		paths = append(paths, filepath.Join(dir, path))
+	}
+	scanOptions := ScanOptions{Exclusions: ignore.MustParse("vendor\nexcluded/\n"), FileSizeThreshold: 6}
+	duplicates, duplicateCount, savingsSize, allFiles, err := FindDuplicatesOfFiles(paths, scanOptions, 2,
+		nil, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(allFiles), "excluded, small, missing and non-regular files should've been skipped")
+	assert.Equal(t, 1, duplicates.Size())
+	assert.Equal(t, int64(1), duplicateCount)
+	assert.Equal(t, int64(len("listed thrice")), savingsSize)
+}
@@ -2,6 +2,8 @@ package service
 
 import (
 	"fmt"
+	"path/filepath"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -13,107 +15,306 @@ import (
 	"github.com/m-manu/go-find-duplicates/utils"
 )
 
-// FindDuplicates finds duplicate files in a given set of directories and matching criteria
-func FindDuplicates(directories []string, excludedFiles set.Set[string], fileSizeThreshold int64, parallelism int,
-	isThorough bool) (
+// FindDuplicates finds duplicate files in a given set of directories and matching criteria. The summary printed breaks
+// down files found by device, if they were found on more than one.
+// Paths that are hard links to the same file are treated as one file (see FindHardLinks): only the first of them is
+// part of the duplicates returned.
+// Those of the directories that are in referenceDirectories are reference directories: groups of duplicates entirely
+// within them aren't returned.
+// Hashes are reused from (and recorded in) the cache, which may be nil.
+// Across all goroutines, no more than maxMemory bytes are used for reading files (unless it's 0, which means no limit).
+func FindDuplicates(directories []string, referenceDirectories set.Set[string], scanOptions ScanOptions,
+	parallelism int, cache *HashCache, maxMemory int64) (
 	duplicates *entity.DigestToFiles, duplicateTotalCount int64, savingsSize int64,
 	allFiles entity.FilePathToMeta, err error,
 ) {
 	fmte.Printf("Scanning %d directories...\n", len(directories))
 	allFiles = make(entity.FilePathToMeta, 10_000)
 	var totalSize int64
-	for _, dirPath := range directories {
-		size, pErr := populateFilesFromDirectory(dirPath, excludedFiles, fileSizeThreshold, allFiles)
+	var skippedDirs []string
+	for i, dirPath := range directories {
+		size, skipped, pErr := populateFilesFromDirectory(dirPath, i, referenceDirectories.Contains(dirPath),
+			scanOptions, parallelism, allFiles)
 		if pErr != nil {
 			err = fmt.Errorf("error while scaning directory %s: %+v", dirPath, pErr)
 			return
 		}
 		totalSize += size
+		skippedDirs = append(skippedDirs, skipped...)
 	}
+	markReferenceFiles(allFiles, referenceDirectories)
 	fmte.Printf("Done. Found %d files of total size %s.\n", len(allFiles), bytesutil.BinaryFormat(totalSize))
+	printSkippedDirs(skippedDirs)
+	printDeviceSummary(allFiles)
+	duplicates, duplicateTotalCount, savingsSize = findDuplicatesAmong(allFiles, parallelism, cache, maxMemory)
+	return
+}
+
+// FindDuplicatesOfFiles is like FindDuplicates, but finds duplicates among the files listed (instead of files found by
+// scanning directories). Files excluded as per scanOptions (or under directories excluded) and files smaller than the
+// minimum size are disregarded, while paths that aren't readable files are reported and skipped.
+func FindDuplicatesOfFiles(paths []string, scanOptions ScanOptions, parallelism int, cache *HashCache,
+	maxMemory int64) (
+	duplicates *entity.DigestToFiles, duplicateTotalCount int64, savingsSize int64,
+	allFiles entity.FilePathToMeta, err error,
+) {
+	fmte.Printf("Reading %d files listed...\n", len(paths))
+	allFiles = make(entity.FilePathToMeta, len(paths))
+	totalSize := populateFilesFromList(paths, scanOptions, allFiles)
+	fmte.Printf("Done. Found %d files of total size %s.\n", len(allFiles), bytesutil.BinaryFormat(totalSize))
+	printDeviceSummary(allFiles)
+	duplicates, duplicateTotalCount, savingsSize = findDuplicatesAmong(allFiles, parallelism, cache, maxMemory)
+	return
+}
+
+// findDuplicatesAmong finds duplicates among the files found, by running them through the hashing pipeline
+func findDuplicatesAmong(allFiles entity.FilePathToMeta, parallelism int, cache *HashCache, maxMemory int64) (
+	duplicates *entity.DigestToFiles, duplicateTotalCount int64, savingsSize int64,
+) {
 	if len(allFiles) == 0 {
 		return
 	}
+	links := FindHardLinks(allFiles)
+	if len(links) > 0 {
+		linkedCount := 0
+		for _, linkedPaths := range links {
+			linkedCount += len(linkedPaths)
+		}
+		fmte.Printf("Of these, %d are hard links to other files found (they won't be counted as duplicates).\n",
+			linkedCount)
+	}
 	fmte.Printf("Finding potential duplicates... \n")
-	shortlist := identifyShortList(allFiles)
+	shortlist := identifyShortList(withoutLinkedPaths(allFiles, links))
 	if len(shortlist) == 0 {
 		return
 	}
 	fmte.Printf("Completed. Found %d files that may have one or more duplicates!\n", len(shortlist))
-	if isThorough {
-		fmte.Printf("Thoroughly scanning for duplicates... \n")
-	} else {
-		fmte.Printf("Scanning for duplicates... \n")
+	fmte.Printf("Scanning for duplicates... \n")
+	duplicates = computeDigestsAndGroupThem(shortlist, allFiles, parallelism, cache, newMemoryBudget(maxMemory))
+	removeReferenceOnlyGroups(duplicates, allFiles)
+	duplicateTotalCount, savingsSize = countDuplicates(duplicates, allFiles)
+	fmte.Printf("Scan completed.\n")
+	return
+}
+
+// markReferenceFiles marks files under reference directories as such, including those found while scanning other
+// directories (i.e. when a reference directory is inside another input directory)
+func markReferenceFiles(allFiles entity.FilePathToMeta, referenceDirectories set.Set[string]) {
+	if referenceDirectories.Cardinality() == 0 {
+		return
 	}
-	var processedCount int32
-	var wg sync.WaitGroup
-	wg.Add(2)
-	go func(pc *int32, fc int32) {
-		defer wg.Done()
-		time.Sleep(200 * time.Millisecond)
-		for atomic.LoadInt32(pc) < fc {
-			time.Sleep(2 * time.Second)
-			progress := float64(atomic.LoadInt32(pc)) / float64(fc)
-			fmte.Printf("%2.0f%% processed so far\n", progress*100.0)
+	for path, meta := range allFiles {
+		if meta.IsReference {
+			continue
 		}
-	}(&processedCount, int32(len(shortlist)))
-	go func(p *int32) {
-		defer wg.Done()
-		duplicates = entity.NewDigestToFiles()
-		computeDigestsAndGroupThem(shortlist, parallelism, p, duplicates, isThorough)
-		for iter := duplicates.Iterator(); iter.HasNext(); {
-			digest, files := iter.Next()
-			numDuplicates := int64(len(files)) - 1
-			duplicateTotalCount += numDuplicates
-			savingsSize += numDuplicates * digest.FileSize
+		for _, dir := range referenceDirectories.ToSlice() {
+			if strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator)) {
+				meta.IsReference = true
+				allFiles[path] = meta
+				break
+			}
 		}
-	}(&processedCount)
-	wg.Wait()
-	fmte.Printf("Scan completed.\n")
-	return
+	}
 }
 
-func computeDigestsAndGroupThem(shortlist entity.FileExtAndSizeToFiles, parallelism int,
-	processedCount *int32, duplicates *entity.DigestToFiles, isThorough bool,
+// removeReferenceOnlyGroups removes groups of duplicates in which all files are in reference directories
+func removeReferenceOnlyGroups(duplicates *entity.DigestToFiles, allFiles entity.FilePathToMeta) {
+	var toRemove []entity.FileDigest
+	for iter := duplicates.Iterator(); iter.HasNext(); {
+		digest, files := iter.Next()
+		if countReferences(files, allFiles) == len(files) {
+			toRemove = append(toRemove, *digest)
+		}
+	}
+	for _, digest := range toRemove {
+		duplicates.Remove(digest)
+	}
+}
+
+// countDuplicates counts the duplicates (i.e. all but one in every group, except files in reference directories and
+// files reached through symbolic links) and their total size. Size of duplicates that have other hard links isn't
+// counted, as removing them wouldn't free any space (the file kept is one of those, if there are any: see
+// action.ChooseSurvivor).
+func countDuplicates(duplicates *entity.DigestToFiles, allFiles entity.FilePathToMeta) (
+	duplicateTotalCount int64, savingsSize int64,
 ) {
-	// Find potential duplicates:
-	slKeys := make([]entity.FileExtAndSize, 0, len(shortlist))
-	for extAndSize := range shortlist {
-		slKeys = append(slKeys, extAndSize)
+	for iter := duplicates.Iterator(); iter.HasNext(); {
+		digest, files := iter.Next()
+		numReferences := countReferences(files, allFiles)
+		numDuplicates := int64(len(files) - numReferences - countViaLinks(files, allFiles))
+		numLinked := int64(countLinked(files, allFiles))
+		if numReferences == 0 && numDuplicates > 0 {
+			numDuplicates-- // one of them is kept
+			if numLinked > 0 {
+				numLinked--
+			}
+		}
+		duplicateTotalCount += numDuplicates
+		savingsSize += (numDuplicates - numLinked) * digest.FileSize
+	}
+	return duplicateTotalCount, savingsSize
+}
+
+// countReferences counts the files that are in reference directories
+func countReferences(files []string, allFiles entity.FilePathToMeta) (count int) {
+	for _, path := range files {
+		if allFiles[path].IsReference {
+			count++
+		}
 	}
+	return count
+}
+
+// countViaLinks counts the files, other than those in reference directories, that were reached through symbolic links
+func countViaLinks(files []string, allFiles entity.FilePathToMeta) (count int) {
+	for _, path := range files {
+		if allFiles[path].ViaLink && !allFiles[path].IsReference {
+			count++
+		}
+	}
+	return count
+}
+
+// countLinked counts the files, other than those in reference directories and those reached through symbolic links,
+// that have other hard links (whether or not those were found)
+func countLinked(files []string, allFiles entity.FilePathToMeta) (count int) {
+	for _, path := range files {
+		if meta := allFiles[path]; meta.NumLinks > 1 && !meta.IsReference && !meta.ViaLink {
+			count++
+		}
+	}
+	return count
+}
+
+// computeDigestsAndGroupThem runs the shortlisted files through the stages of the hashing pipeline. Only files that
+// collide with some other file after a stage are hashed in the next stage.
+func computeDigestsAndGroupThem(shortlist entity.FileExtAndSizeToFiles, allFiles entity.FilePathToMeta,
+	parallelism int, cache *HashCache, budget *memoryBudget,
+) (duplicates *entity.DigestToFiles) {
+	groups := make([][]string, 0, len(shortlist))
+	for _, paths := range shortlist {
+		groups = append(groups, paths)
+	}
+	groups, hashes := hashInStages(groups, nil, isViaLinkIn(allFiles), parallelism, cache, budget)
+	duplicates = entity.NewDigestToFiles()
+	for _, paths := range groups {
+		for _, path := range paths {
+			duplicates.Set(entity.FileDigest{
+				FileExtension: utils.GetFileExt(path),
+				FileSize:      allFiles[path].Size,
+				FileHash:      hashes[path],
+			}, path)
+		}
+	}
+	return duplicates
+}
+
+// hashInStages runs the groups of files through the stages of the hashing pipeline, returning groups of files that
+// collide even after the last stage, along with their hashes. Groups for which isWanted (if not nil) returns false
+// are dropped after every stage. isViaLink tells whether a file was reached through symbolic links.
+func hashInStages(groups [][]string, isWanted func(paths []string) bool, isViaLink func(path string) bool,
+	parallelism int, cache *HashCache, budget *memoryBudget,
+) (collidingGroups [][]string, hashes map[string]string) {
+	for i, stage := range hashStages {
+		fmte.Printf("Stage %d of %d: hashing %s of %d files...\n", i+1, len(hashStages), stage, countFiles(groups))
+		groups, hashes = hashAndRegroup(groups, stage, isViaLink, parallelism, cache, budget)
+		if isWanted != nil {
+			wantedGroups := groups[:0]
+			for _, paths := range groups {
+				if isWanted(paths) {
+					wantedGroups = append(wantedGroups, paths)
+				}
+			}
+			groups = wantedGroups
+		}
+		if len(groups) == 0 {
+			break
+		}
+	}
+	return groups, hashes
+}
+
+// hashAndRegroup computes hashes of the given stage for all files in the groups and splits every group by those
+// hashes. Files that don't collide with any other file are dropped.
+func hashAndRegroup(groups [][]string, stage hashStage, isViaLink func(path string) bool, parallelism int,
+	cache *HashCache, budget *memoryBudget,
+) (
+	collidingGroups [][]string, hashes map[string]string,
+) {
+	hashes = make(map[string]string, countFiles(groups))
+	var mx sync.Mutex
+	var processedCount int32
+	done := make(chan struct{})
+	go showProgress(&processedCount, int32(countFiles(groups)), done)
 	var wg sync.WaitGroup
 	wg.Add(parallelism)
 	for i := 0; i < parallelism; i++ {
 		go func(shard int, wg *sync.WaitGroup, count *int32) {
 			defer wg.Done()
-			low := shard * len(slKeys) / parallelism
-			high := (shard + 1) * len(slKeys) / parallelism
-			for _, fileExtAndSize := range slKeys[low:high] {
-				for _, path := range shortlist[fileExtAndSize] {
-					digest, err := GetDigest(path, isThorough)
+			low := shard * len(groups) / parallelism
+			high := (shard + 1) * len(groups) / parallelism
+			for _, paths := range groups[low:high] {
+				var hashOrder []string
+				hashToPaths := make(map[string][]string, len(paths))
+				for _, path := range paths {
+					h, err := fileHash(path, isViaLink(path), stage, cache, budget)
+					atomic.AddInt32(count, 1)
 					if err != nil {
 						fmte.Printf("error while scanning %s: %+v\n", path, err)
 						continue
 					}
-					duplicates.Set(digest, path)
+					if _, exists := hashToPaths[h]; !exists {
+						hashOrder = append(hashOrder, h)
+					}
+					hashToPaths[h] = append(hashToPaths[h], path)
 				}
-				atomic.AddInt32(count, 1)
+				mx.Lock()
+				for _, h := range hashOrder {
+					if len(hashToPaths[h]) <= 1 {
+						continue
+					}
+					collidingGroups = append(collidingGroups, hashToPaths[h])
+					for _, path := range hashToPaths[h] {
+						hashes[path] = h
+					}
+				}
+				mx.Unlock()
 			}
-		}(i, &wg, processedCount)
+		}(i, &wg, &processedCount)
 	}
 	wg.Wait()
-	// Remove non-duplicates
-	var duplicateKeys []entity.FileDigest
-	for iter := duplicates.Iterator(); iter.HasNext(); {
-		digest, files := iter.Next()
-		if len(files) <= 1 {
-			duplicateKeys = append(duplicateKeys, *digest)
+	close(done)
+	return collidingGroups, hashes
+}
+
+// isViaLinkIn returns a function that tells whether a file in allFiles was reached through symbolic links
+func isViaLinkIn(allFiles entity.FilePathToMeta) func(path string) bool {
+	return func(path string) bool {
+		return allFiles[path].ViaLink
+	}
+}
+
+// showProgress periodically prints the percentage of files processed, until done is closed
+func showProgress(processedCount *int32, totalCount int32, done <-chan struct{}) {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			progress := float64(atomic.LoadInt32(processedCount)) / float64(totalCount)
+			fmte.Printf("%2.0f%% processed so far\n", progress*100.0)
 		}
 	}
-	for _, key := range duplicateKeys {
-		duplicates.Remove(key)
+}
+
+// countFiles counts the files across all groups
+func countFiles(groups [][]string) (count int) {
+	for _, paths := range groups {
+		count += len(paths)
 	}
-	return
+	return count
 }
 
 // identifyShortList identifies the files that may have duplicates
@@ -1,13 +1,16 @@
 package service
 
 import (
+	"bytes"
 	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/go-find-duplicates/bytesutil"
 	"github.com/m-manu/go-find-duplicates/entity"
 	"github.com/m-manu/go-find-duplicates/fmte"
-	"github.com/m-manu/go-find-duplicates/utils"
+	"github.com/m-manu/go-find-duplicates/ignore"
 	"github.com/stretchr/testify/assert"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"testing"
 )
 
@@ -24,32 +27,33 @@ func TestFindDuplicates(t *testing.T) {
 		filepath.Join(goRoot, "src"),
 		filepath.Join(goRoot, "test"),
 	}
-	exclusions, _ := utils.LineSeparatedStrToMap(exclusionsStr)
+	scanOptions := ScanOptions{Exclusions: ignore.MustParse(exclusionsStr), FileSizeThreshold: 4_196}
 	fmte.Off()
-	duplicates, duplicateCount, savingsSize, _, err := FindDuplicates(directories, exclusions,
-		4_196, 2, false)
+	duplicates, duplicateCount, savingsSize, _, err := FindDuplicates(directories, set.NewSet[string](), scanOptions,
+		2, nil, 0)
 	assert.Nil(t, err)
 	assert.GreaterOrEqual(t, duplicates.Size(), 0)
 	assert.GreaterOrEqual(t, duplicateCount, int64(0))
 	assert.GreaterOrEqual(t, savingsSize, int64(0))
 }
 
-// TestNonThoroughVsNot checks whether FindDuplicates with 'thorough mode' on and off returns the same results
-func TestNonThoroughVsNot(t *testing.T) {
-	exclusions, _ := utils.LineSeparatedStrToMap(exclusionsStr)
+// TestFindDuplicatesIsConsistent checks whether FindDuplicates returns the same results, irrespective of parallelism
+// and memory limit
+func TestFindDuplicatesIsConsistent(t *testing.T) {
+	scanOptions := ScanOptions{Exclusions: ignore.MustParse(exclusionsStr), FileSizeThreshold: 4_196}
 	goRoot := []string{runtime.GOROOT()}
 	fmte.Off()
-	duplicatesExpected, duplicateCountExpected, savingsSizeExpected, _, tErr := FindDuplicates(goRoot, exclusions,
-		4_196, 2, false)
+	duplicatesExpected, duplicateCountExpected, savingsSizeExpected, _, tErr := FindDuplicates(goRoot,
+		set.NewSet[string](), scanOptions, 2, nil, 0)
 	assert.Nil(t, tErr, "error while scanning for duplicates in GOROOT directory")
-	duplicatesActual, duplicateCountActual, savingsSizeActual, _, ntErr := FindDuplicates(goRoot, exclusions,
-		4_196, 5, true)
-	assert.Nil(t, ntErr, "error while thoroughly scanning for duplicates in GOROOT directory")
+	duplicatesActual, duplicateCountActual, savingsSizeActual, _, ntErr := FindDuplicates(goRoot,
+		set.NewSet[string](), scanOptions, 5, nil, bytesutil.MEBI)
+	assert.Nil(t, ntErr, "error while scanning for duplicates in GOROOT directory with a memory limit")
 	actualDuplicateFilePaths := extractFiles(duplicatesActual)
 	expectedDuplicateFilePaths := extractFiles(duplicatesExpected)
-	assert.True(t, actualDuplicateFilePaths.Equal(expectedDuplicateFilePaths), "Duplicate files differed between thorough and non-thorough modes")
-	assert.Equal(t, duplicateCountExpected, duplicateCountActual, "Number of duplicates differed between thorough and non-thorough modes")
-	assert.Equal(t, savingsSizeExpected, savingsSizeActual, "Savings expected differed between thorough and non-thorough modes")
+	assert.True(t, actualDuplicateFilePaths.Equal(expectedDuplicateFilePaths), "Duplicate files differed with a memory limit")
+	assert.Equal(t, duplicateCountExpected, duplicateCountActual, "Number of duplicates differed with a memory limit")
+	assert.Equal(t, savingsSizeExpected, savingsSizeActual, "Savings expected differed with a memory limit")
 }
 
 func extractFiles(duplicatesExpected *entity.DigestToFiles) set.Set[string] {
@@ -62,3 +66,101 @@ func extractFiles(duplicatesExpected *entity.DigestToFiles) set.Set[string] {
 	}
 	return expectedDuplicatesFiles
 }
+
+func TestFindDuplicatesWithReference(t *testing.T) {
+	fmte.Off()
+	dir := t.TempDir()
+	createFiles(t, dir, map[string]string{
+		"master/a.txt":      "in master and elsewhere",
+		"master/copy/a.txt": "in master and elsewhere",
+		"master/b.txt":      "only in master",
+		"master/copy/b.txt": "only in master",
+		"other/a.txt":       "in master and elsewhere",
+		"other/c.txt":       "not in master",
+		"other/copy/c.txt":  "not in master",
+	})
+	master, other := filepath.Join(dir, "master"), filepath.Join(dir, "other")
+	duplicates, duplicateCount, savingsSize, allFiles, err := FindDuplicates([]string{other, master},
+		set.NewSet(master), ScanOptions{}, 2, nil, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, duplicates.Size(), "group with just files in master should've been left out")
+	assert.Equal(t, int64(2), duplicateCount)
+	assert.Equal(t, int64(len("in master and elsewhere")+len("not in master")), savingsSize)
+	assert.Equal(t, 1, allFiles[filepath.Join(master, "a.txt")].Root)
+	assert.True(t, allFiles[filepath.Join(master, "a.txt")].IsReference)
+	assert.Equal(t, 0, allFiles[filepath.Join(other, "a.txt")].Root)
+	assert.False(t, allFiles[filepath.Join(other, "a.txt")].IsReference)
+}
+
+func TestFindDuplicatesWithNestedReference(t *testing.T) {
+	fmte.Off()
+	dir := t.TempDir()
+	createFiles(t, dir, map[string]string{
+		"photos/a.jpg":             "in master and elsewhere",
+		"photos/master/a.jpg":      "in master and elsewhere",
+		"photos/master/b.jpg":      "only in master",
+		"photos/master/copy/b.jpg": "only in master",
+	})
+	photos, master := filepath.Join(dir, "photos"), filepath.Join(dir, "photos", "master")
+	for _, directories := range [][]string{{photos, master}, {master, photos}} {
+		duplicates, duplicateCount, _, allFiles, err := FindDuplicates(directories, set.NewSet(master),
+			ScanOptions{}, 2, nil, 0)
+		assert.Nil(t, err)
+		assert.Equal(t, [][]string{{"a.jpg", "master/a.jpg"}}, groupsOf(photos, duplicates),
+			"group with just files in master should've been left out")
+		assert.Equal(t, int64(1), duplicateCount)
+		assert.True(t, allFiles[filepath.Join(master, "a.jpg")].IsReference)
+		assert.True(t, allFiles[filepath.Join(master, "copy", "b.jpg")].IsReference)
+		assert.False(t, allFiles[filepath.Join(photos, "a.jpg")].IsReference)
+	}
+}
+
+func TestFindDuplicatesHashesInStages(t *testing.T) {
+	fmte.Off()
+	dir := t.TempDir()
+	base := make([]byte, 40*bytesutil.KIBI)
+	for i := range base {
+		base[i] = byte(i % 251)
+	}
+	// withByte returns contents of base, with the byte at the offset changed
+	withByte := func(offset int, b byte) string {
+		contents := bytes.Clone(base)
+		contents[offset] = b
+		return string(contents)
+	}
+	createFiles(t, dir, map[string]string{
+		"prefix1.bin":  withByte(0, 'x'),      // differs in first few bytes
+		"prefix2.bin":  withByte(0, 'y'),      // differs in first few bytes
+		"crucial1.bin": withByte(5_000, 'x'),  // differs in crucial bytes (but not in first few)
+		"crucial2.bin": withByte(5_000, 'y'),  // differs in crucial bytes (but not in first few)
+		"full1.bin":    withByte(10_000, 'x'), // differs only in bytes not sampled
+		"full2.bin":    withByte(10_000, 'y'), // differs only in bytes not sampled
+		"same1.bin":    withByte(30_000, 'z'),
+		"same2.bin":    withByte(30_000, 'z'),
+	})
+	cache, err := OpenHashCache(filepath.Join(t.TempDir(), "index.db"))
+	assert.Nil(t, err)
+	duplicates, duplicateCount, _, _, err := FindDuplicates([]string{dir}, set.NewSet[string](), ScanOptions{}, 2,
+		cache, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"same1.bin", "same2.bin"}}, groupsOf(dir, duplicates))
+	assert.Equal(t, int64(1), duplicateCount)
+	// Stages a file was hashed in are those whose hashes were cached
+	for name, expectedStages := range map[string][]hashStage{
+		"prefix1.bin":  {stagePrefix},
+		"prefix2.bin":  {stagePrefix},
+		"crucial1.bin": {stagePrefix, stageCrucial},
+		"crucial2.bin": {stagePrefix, stageCrucial},
+		"full1.bin":    {stagePrefix, stageCrucial, stageFull},
+		"full2.bin":    {stagePrefix, stageCrucial, stageFull},
+		"same1.bin":    {stagePrefix, stageCrucial, stageFull},
+		"same2.bin":    {stagePrefix, stageCrucial, stageFull},
+	} {
+		var stages []hashStage
+		for stage := range cache.entries[filepath.Join(dir, name)].Hashes {
+			stages = append(stages, stage)
+		}
+		slices.Sort(stages)
+		assert.Equal(t, expectedStages, stages, name)
+	}
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"sort"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+)
+
+// fileID identifies a file uniquely, irrespective of the paths (hard links) through which it's reached
+type fileID struct {
+	device, inode uint64
+}
+
+// FindHardLinks finds files that have multiple paths (i.e. hard links to the same inode, or symbolic links to the same
+// file, if those were followed). For every such file, the returned map has its first path (in sorted order, with paths
+// not reached through symbolic links first), mapped to the rest of its paths (which are "already linked" to the first
+// one).
+func FindHardLinks(allFiles entity.FilePathToMeta) (links map[string][]string) {
+	idToPaths := make(map[fileID][]string)
+	for path, meta := range allFiles {
+		if meta.Inode == 0 {
+			continue
+		}
+		id := fileID{meta.Device, meta.Inode}
+		idToPaths[id] = append(idToPaths[id], path)
+	}
+	links = make(map[string][]string)
+	for _, paths := range idToPaths {
+		if len(paths) <= 1 {
+			continue
+		}
+		sort.Slice(paths, func(i, j int) bool {
+			if allFiles[paths[i]].ViaLink != allFiles[paths[j]].ViaLink {
+				return !allFiles[paths[i]].ViaLink
+			}
+			return paths[i] < paths[j]
+		})
+		links[paths[0]] = paths[1:]
+	}
+	return links
+}
+
+// withoutLinkedPaths gets the files, excluding paths that are already linked to another path
+func withoutLinkedPaths(allFiles entity.FilePathToMeta, links map[string][]string) entity.FilePathToMeta {
+	if len(links) == 0 {
+		return allFiles
+	}
+	files := make(entity.FilePathToMeta, len(allFiles))
+	for path, meta := range allFiles {
+		files[path] = meta
+	}
+	for _, linkedPaths := range links {
+		for _, path := range linkedPaths {
+			delete(files, path)
+		}
+	}
+	return files
+}
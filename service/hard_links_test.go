@@ -0,0 +1,65 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindDuplicatesWithHardLinks(t *testing.T) {
+	fmte.Off()
+	dir := t.TempDir()
+	createFiles(t, dir, map[string]string{
+		"a.txt":        "linked and copied",
+		"copy/a.txt":   "linked and copied",
+		"only/b.txt":   "linked only",
+		"unrelated.md": "no duplicates",
+	})
+	for link, target := range map[string]string{"link/a.txt": "a.txt", "link/b.txt": "only/b.txt"} {
+		assert.Nil(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, link)), 0755))
+		if err := os.Link(filepath.Join(dir, target), filepath.Join(dir, link)); err != nil {
+			t.Skipf("hard links not supported: %+v", err)
+		}
+	}
+	duplicates, duplicateCount, savingsSize, allFiles, err := FindDuplicates([]string{dir}, set.NewSet[string](),
+		ScanOptions{}, 2, nil, 0)
+	assert.Nil(t, err)
+	assert.True(t, set.NewThreadUnsafeSet(filepath.Join(dir, "a.txt"), filepath.Join(dir, "copy/a.txt")).
+		Equal(extractFiles(duplicates)), "already linked paths shouldn't be duplicates")
+	assert.Equal(t, int64(1), duplicateCount)
+	assert.Equal(t, int64(len("linked and copied")), savingsSize)
+	assert.Equal(t, map[string][]string{
+		filepath.Join(dir, "a.txt"):      {filepath.Join(dir, "link/a.txt")},
+		filepath.Join(dir, "link/b.txt"): {filepath.Join(dir, "only/b.txt")},
+	}, FindHardLinks(allFiles))
+}
+
+func TestSavingsWhenDuplicatesHaveHardLinks(t *testing.T) {
+	fmte.Off()
+	dir := t.TempDir()
+	createFiles(t, dir, map[string]string{
+		"a/x.txt": "copied and linked",
+		"b/x.txt": "copied and linked",
+		"c/x.txt": "copied and linked",
+	})
+	// Other links to a/x.txt and b/x.txt (outside the directory scanned)
+	outside := t.TempDir()
+	for _, name := range []string{"a", "b"} {
+		if err := os.Link(filepath.Join(dir, name, "x.txt"), filepath.Join(outside, name+".txt")); err != nil {
+			t.Skipf("hard links not supported: %+v", err)
+		}
+	}
+	_, duplicateCount, savingsSize, allFiles, err := FindDuplicates([]string{dir}, set.NewSet[string](),
+		ScanOptions{}, 2, nil, 0)
+	assert.Nil(t, err)
+	if allFiles[filepath.Join(dir, "a/x.txt")].NumLinks == 0 {
+		t.Skip("number of hard links to a file can't be found on this platform")
+	}
+	// One of the linked files is kept, while removing the other frees nothing: only c/x.txt counts towards savings
+	assert.Equal(t, int64(2), duplicateCount)
+	assert.Equal(t, int64(len("copied and linked")), savingsSize)
+}
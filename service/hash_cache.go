@@ -0,0 +1,175 @@
+package service
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/utils"
+)
+
+// hashCacheVersion is the version of the on-disk format of HashCache. This needs to be bumped whenever the format
+// or the meaning of persisted hashes (including numbering of hash stages) changes.
+const hashCacheVersion = 2
+
+// HashCache is a persistent store of hashes of files, so that files that haven't changed since an earlier run need
+// not be read again. Hashes are recorded per hash stage, so hashes of different stages never mix.
+// Reads and writes to this are goroutine-safe. A nil *HashCache is valid and caches nothing.
+type HashCache struct {
+	path    string
+	mx      sync.Mutex
+	entries map[string]hashCacheEntry
+	seen    map[string]struct{}
+}
+
+// hashCacheEntry is what is persisted for every file
+type hashCacheEntry struct {
+	Size              int64
+	ModifiedTimestamp int64
+	Inode             uint64
+	ViaLink           bool // whether metadata is of the file the path points to (if it's a symbolic link)
+	Hashes            map[hashStage]string
+}
+
+// newHashCacheEntry creates a hashCacheEntry, without any hashes, for the file whose metadata is provided
+func newHashCacheEntry(info os.FileInfo, viaLink bool) hashCacheEntry {
+	_, inode, _ := utils.GetFileID(info)
+	return hashCacheEntry{
+		Size:              info.Size(),
+		ModifiedTimestamp: info.ModTime().Unix(),
+		Inode:             inode,
+		ViaLink:           viaLink,
+		Hashes:            make(map[hashStage]string, 1),
+	}
+}
+
+// isSameFileAs checks whether the entry still corresponds to the file whose metadata is provided
+func (e hashCacheEntry) isSameFileAs(info os.FileInfo) bool {
+	_, inode, _ := utils.GetFileID(info)
+	return e.Size == info.Size() && e.ModifiedTimestamp == info.ModTime().Unix() && e.Inode == inode
+}
+
+// hashCacheFile is the on-disk representation of HashCache
+type hashCacheFile struct {
+	Version int
+	Entries map[string]hashCacheEntry
+}
+
+// OpenHashCache loads the hash cache from the file provided. If the file doesn't exist (or was created by an
+// incompatible version of this tool), an empty cache is returned and the file is created upon Save.
+func OpenHashCache(path string) (*HashCache, error) {
+	c := &HashCache{
+		path:    path,
+		entries: make(map[string]hashCacheEntry),
+		seen:    make(map[string]struct{}),
+	}
+	f, openErr := os.Open(path)
+	if errors.Is(openErr, fs.ErrNotExist) {
+		return c, nil
+	} else if openErr != nil {
+		return nil, fmt.Errorf("couldn't open hash cache: %+v", openErr)
+	}
+	defer f.Close()
+	var contents hashCacheFile
+	if decodeErr := gob.NewDecoder(f).Decode(&contents); decodeErr != nil {
+		fmte.PrintfErr("ignoring unreadable hash cache \"%s\": %+v\n", path, decodeErr)
+		return c, nil
+	}
+	if contents.Version != hashCacheVersion {
+		fmte.PrintfErr("ignoring hash cache \"%s\" as it was created by a different version\n", path)
+		return c, nil
+	}
+	if contents.Entries != nil {
+		c.entries = contents.Entries
+	}
+	return c, nil
+}
+
+// Size returns the number of files in the cache
+func (c *HashCache) Size() int {
+	if c == nil {
+		return 0
+	}
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return len(c.entries)
+}
+
+// lookup gets the hash of a stage of a file, if the file hasn't changed since the hash was cached (viaLink is as in
+// store, and needs to be the same as when the hash was cached)
+func (c *HashCache) lookup(path string, viaLink bool, info os.FileInfo, stage hashStage) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	entry, exists := c.entries[path]
+	if !exists || entry.ViaLink != viaLink || !entry.isSameFileAs(info) {
+		return "", false
+	}
+	c.seen[path] = struct{}{}
+	h, exists := entry.Hashes[stage]
+	return h, exists
+}
+
+// store records the hash of a stage of a file, discarding any hashes cached for an earlier version of the file
+// (viaLink tells whether the metadata is of the file the path points to, if it's a symbolic link)
+func (c *HashCache) store(path string, viaLink bool, info os.FileInfo, stage hashStage, h string) {
+	if c == nil {
+		return
+	}
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	entry, exists := c.entries[path]
+	if !exists || entry.ViaLink != viaLink || !entry.isSameFileAs(info) {
+		entry = newHashCacheEntry(info, viaLink)
+	}
+	entry.Hashes[stage] = h
+	c.entries[path] = entry
+	c.seen[path] = struct{}{}
+}
+
+// Save prunes stale entries and writes the cache to disk
+func (c *HashCache) Save() error {
+	if c == nil {
+		return nil
+	}
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	for path, entry := range c.entries {
+		if _, seen := c.seen[path]; seen {
+			continue
+		}
+		stat := os.Lstat
+		if entry.ViaLink {
+			stat = os.Stat
+		}
+		info, statErr := stat(path)
+		if statErr != nil || !entry.isSameFileAs(info) {
+			delete(c.entries, path)
+		}
+	}
+	if mkErr := os.MkdirAll(filepath.Dir(c.path), 0o755); mkErr != nil {
+		return fmt.Errorf("couldn't create directory for hash cache: %+v", mkErr)
+	}
+	f, createErr := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*.tmp")
+	if createErr != nil {
+		return fmt.Errorf("couldn't create hash cache: %+v", createErr)
+	}
+	encodeErr := gob.NewEncoder(f).Encode(hashCacheFile{Version: hashCacheVersion, Entries: c.entries})
+	closeErr := f.Close()
+	if encodeErr != nil || closeErr != nil {
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("couldn't write hash cache: %+v", errors.Join(encodeErr, closeErr))
+	}
+	if renameErr := os.Rename(f.Name(), c.path); renameErr != nil {
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("couldn't write hash cache: %+v", renameErr)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashCache(t *testing.T) {
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "cache", "index.db")
+	filePath := filepath.Join(dir, "a.txt")
+	assert.Nil(t, os.WriteFile(filePath, []byte("hello world"), 0o644))
+
+	cache, err := OpenHashCache(cachePath)
+	assert.Nil(t, err)
+	h, err := fileHash(filePath, false, stageCrucial, cache, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, cache.Save())
+
+	reopened, err := OpenHashCache(cachePath)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, reopened.Size())
+	info, _ := os.Lstat(filePath)
+	cached, found := reopened.lookup(filePath, false, info, stageCrucial)
+	assert.True(t, found)
+	assert.Equal(t, h, cached)
+	_, found = reopened.lookup(filePath, false, info, stageFull)
+	assert.False(t, found, "hashes of one stage shouldn't be served for another")
+
+	// Modified file shouldn't be served from cache
+	assert.Nil(t, os.WriteFile(filePath, []byte("hello there"), 0o644))
+	assert.Nil(t, os.Chtimes(filePath, time.Now(), time.Now().Add(time.Hour)))
+	info, _ = os.Lstat(filePath)
+	_, found = reopened.lookup(filePath, false, info, stageCrucial)
+	assert.False(t, found)
+
+	// Deleted file should be pruned in a subsequent run
+	assert.Nil(t, os.Remove(filePath))
+	nextRun, err := OpenHashCache(cachePath)
+	assert.Nil(t, err)
+	assert.Nil(t, nextRun.Save())
+	pruned, err := OpenHashCache(cachePath)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, pruned.Size())
+}
+
+func TestHashCacheViaLink(t *testing.T) {
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "index.db")
+	filePath, linkPath := filepath.Join(dir, "a.txt"), filepath.Join(dir, "link.txt")
+	assert.Nil(t, os.WriteFile(filePath, []byte("hello world"), 0o644))
+	assert.Nil(t, os.Symlink(filePath, linkPath))
+
+	_, err := fileHash(linkPath, false, stageCrucial, nil, nil)
+	assert.NotNil(t, err, "symbolic link shouldn't be hashed, unless it was reached through links")
+
+	cache, err := OpenHashCache(cachePath)
+	assert.Nil(t, err)
+	h, err := fileHash(linkPath, true, stageCrucial, cache, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, cache.Save())
+
+	// Entry for the link should survive a run in which it wasn't seen, as the file it points to hasn't changed
+	nextRun, err := OpenHashCache(cachePath)
+	assert.Nil(t, err)
+	assert.Nil(t, nextRun.Save())
+	reopened, err := OpenHashCache(cachePath)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, reopened.Size())
+	info, _ := os.Stat(linkPath)
+	cached, found := reopened.lookup(linkPath, true, info, stageCrucial)
+	assert.True(t, found)
+	assert.Equal(t, h, cached)
+	_, found = reopened.lookup(linkPath, false, info, stageCrucial)
+	assert.False(t, found, "hash of the file a link points to shouldn't be served for the link itself")
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"sync"
+)
+
+// memoryBudget limits the number of bytes that goroutines may hold in memory (for reading files) at once.
+// A nil *memoryBudget imposes no limit.
+type memoryBudget struct {
+	cond      *sync.Cond
+	capacity  int64
+	available int64
+}
+
+// newMemoryBudget creates a memoryBudget of given number of bytes, or nil if the capacity isn't positive
+func newMemoryBudget(capacity int64) *memoryBudget {
+	if capacity <= 0 {
+		return nil
+	}
+	return &memoryBudget{
+		cond:      sync.NewCond(&sync.Mutex{}),
+		capacity:  capacity,
+		available: capacity,
+	}
+}
+
+// acquire blocks until the requested number of bytes is available and reserves them. Requests larger than the
+// entire budget are scaled down to it, so the number of bytes actually reserved is returned.
+func (b *memoryBudget) acquire(n int64) int64 {
+	if b == nil {
+		return n
+	}
+	n = min(n, b.capacity)
+	b.cond.L.Lock()
+	for b.available < n {
+		b.cond.Wait()
+	}
+	b.available -= n
+	b.cond.L.Unlock()
+	return n
+}
+
+// release returns bytes reserved earlier using acquire
+func (b *memoryBudget) release(n int64) {
+	if b == nil {
+		return
+	}
+	b.cond.L.Lock()
+	b.available += n
+	b.cond.L.Unlock()
+	b.cond.Broadcast()
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	var unlimited *memoryBudget
+	assert.Equal(t, int64(100), unlimited.acquire(100))
+	unlimited.release(100)
+
+	budget := newMemoryBudget(10)
+	assert.Equal(t, int64(10), budget.acquire(25), "requests larger than budget should be scaled down")
+	budget.release(10)
+
+	var inFlight, maxInFlight int64
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n := budget.acquire(4)
+			current := atomic.AddInt64(&inFlight, n)
+			for {
+				m := atomic.LoadInt64(&maxInFlight)
+				if current <= m || atomic.CompareAndSwapInt64(&maxInFlight, m, current) {
+					break
+				}
+			}
+			atomic.AddInt64(&inFlight, -n)
+			budget.release(n)
+		}()
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, maxInFlight, int64(10))
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/fmte"
+)
+
+// dirPair is a pair of directories, ordered by path
+type dirPair struct {
+	a, b string
+}
+
+// dirOverlaps has sizes of contents of directories and of contents shared between pairs of them. Contents are
+// counted once per directory, however many copies of them the directory has.
+type dirOverlaps struct {
+	totalSizes  map[string]int64
+	sharedSizes map[dirPair]int64
+	children    map[string]map[string]struct{}
+}
+
+// FindOverlappingDirectories finds pairs of directories such that one has all its contents in the other (i.e. is a
+// subset of the other), or both share more than minOverlapPercent of their contents (by size), using duplicates found
+// by FindDuplicates. Only the outermost such pairs are returned: e.g. if a/ is a subset of b/, then a/x/ being a
+// subset of b/ isn't returned.
+func FindOverlappingDirectories(duplicates *entity.DigestToFiles, allFiles entity.FilePathToMeta,
+	directories []string, minOverlapPercent float64,
+) (overlaps []entity.DirectoryOverlap) {
+	fmte.Printf("Finding overlapping directories...\n")
+	o := dirOverlaps{
+		totalSizes:  make(map[string]int64),
+		sharedSizes: make(map[dirPair]int64),
+		children:    make(map[string]map[string]struct{}),
+	}
+	grouped := make(map[string]struct{})
+	links := FindHardLinks(allFiles)
+	for iter := duplicates.Iterator(); iter.HasNext(); {
+		digest, paths := iter.Next()
+		dirSet := make(map[string]struct{})
+		for _, path := range paths {
+			for _, p := range append([]string{path}, links[path]...) {
+				grouped[p] = struct{}{}
+				for _, dir := range o.ancestorsOf(p, directories) {
+					dirSet[dir] = struct{}{}
+				}
+			}
+		}
+		dirs := make([]string, 0, len(dirSet))
+		for dir := range dirSet {
+			dirs = append(dirs, dir)
+		}
+		sort.Strings(dirs)
+		for i, dir := range dirs {
+			o.totalSizes[dir] += digest.FileSize
+			for _, otherDir := range dirs[i+1:] {
+				if !areNested(dir, otherDir) {
+					o.sharedSizes[dirPair{dir, otherDir}] += digest.FileSize
+				}
+			}
+		}
+	}
+	for path, meta := range withoutLinkedPaths(allFiles, links) {
+		if _, exists := grouped[path]; exists {
+			continue
+		}
+		for _, dir := range o.ancestorsOf(path, directories) {
+			o.totalSizes[dir] += meta.Size
+		}
+	}
+	for pair, sharedSize := range o.sharedSizes {
+		overlap := entity.DirectoryOverlap{
+			Dir:             pair.a,
+			OtherDir:        pair.b,
+			SharedSize:      sharedSize,
+			UniqueSize:      o.totalSizes[pair.a] - sharedSize,
+			OtherUniqueSize: o.totalSizes[pair.b] - sharedSize,
+		}
+		if overlap.OtherUniqueSize == 0 && overlap.UniqueSize > 0 {
+			overlap.Dir, overlap.OtherDir = overlap.OtherDir, overlap.Dir
+			overlap.UniqueSize, overlap.OtherUniqueSize = overlap.OtherUniqueSize, overlap.UniqueSize
+		}
+		overlap.IsSubset = overlap.UniqueSize == 0
+		if overlap.IsSubset && o.isOutermostSubset(overlap.Dir, overlap.OtherDir) ||
+			!overlap.IsSubset && overlap.OverlapPercent() > minOverlapPercent &&
+				!o.isOverlapping(filepath.Dir(pair.a), filepath.Dir(pair.b), minOverlapPercent) {
+			overlaps = append(overlaps, overlap)
+		}
+	}
+	sort.Slice(overlaps, func(i, j int) bool {
+		if overlaps[i].IsSubset != overlaps[j].IsSubset {
+			return overlaps[i].IsSubset
+		}
+		if overlaps[i].SharedSize != overlaps[j].SharedSize {
+			return overlaps[i].SharedSize > overlaps[j].SharedSize
+		}
+		return overlaps[i].Dir+"\x00"+overlaps[i].OtherDir < overlaps[j].Dir+"\x00"+overlaps[j].OtherDir
+	})
+	return overlaps
+}
+
+// ancestorsOf gets the directories under which the file is, up to the outermost input directory containing it (while
+// recording the parent-child relationships between them)
+func (o *dirOverlaps) ancestorsOf(path string, directories []string) (dirs []string) {
+	root := outermostRootOf(path, directories)
+	if root == "" {
+		return nil
+	}
+	for dir := filepath.Dir(path); len(dir) >= len(root); dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+		if dir == root {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if o.children[parent] == nil {
+			o.children[parent] = make(map[string]struct{})
+		}
+		o.children[parent][dir] = struct{}{}
+	}
+	return dirs
+}
+
+// sharedSizeOf gets the size of contents shared between directories
+func (o *dirOverlaps) sharedSizeOf(dir string, otherDir string) int64 {
+	if dir > otherDir {
+		dir, otherDir = otherDir, dir
+	}
+	return o.sharedSizes[dirPair{dir, otherDir}]
+}
+
+// isSubset checks whether all contents of dir are found in otherDir
+func (o *dirOverlaps) isSubset(dir string, otherDir string) bool {
+	sharedSize := o.sharedSizeOf(dir, otherDir)
+	return sharedSize > 0 && sharedSize == o.totalSizes[dir]
+}
+
+// isOutermostSubset checks whether dir, a subset of otherDir, is the outermost such directory and otherDir is the
+// innermost directory containing it
+func (o *dirOverlaps) isOutermostSubset(dir string, otherDir string) bool {
+	if o.isSubset(filepath.Dir(dir), otherDir) {
+		return false
+	}
+	for child := range o.children[otherDir] {
+		if o.isSubset(dir, child) {
+			return false
+		}
+	}
+	return true
+}
+
+// isOverlapping checks whether one of the directories is a subset of the other or they share more than
+// minOverlapPercent of their contents
+func (o *dirOverlaps) isOverlapping(dir string, otherDir string, minOverlapPercent float64) bool {
+	sharedSize := o.sharedSizeOf(dir, otherDir)
+	overlap := entity.DirectoryOverlap{
+		SharedSize:      sharedSize,
+		UniqueSize:      o.totalSizes[dir] - sharedSize,
+		OtherUniqueSize: o.totalSizes[otherDir] - sharedSize,
+	}
+	return sharedSize > 0 &&
+		(overlap.UniqueSize == 0 || overlap.OtherUniqueSize == 0 || overlap.OverlapPercent() > minOverlapPercent)
+}
+
+// areNested checks whether either of the directories is inside the other one
+func areNested(dir string, otherDir string) bool {
+	isUnder := func(path string, ancestor string) bool {
+		return strings.HasPrefix(path, strings.TrimSuffix(ancestor, string(filepath.Separator))+
+			string(filepath.Separator))
+	}
+	return dir == otherDir || isUnder(dir, otherDir) || isUnder(otherDir, dir)
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindOverlappingDirectories(t *testing.T) {
+	fmte.Off()
+	dir := t.TempDir()
+	createFiles(t, dir, map[string]string{
+		"backup/2019/x.jpg":     "xxxx",
+		"backup/2019/y.jpg":     "yyyy",
+		"photos/trip/x.jpg":     "xxxx",
+		"photos/home/y.jpg":     "yyyy",
+		"photos/home/z.jpg":     "zzzz",
+		"docs/a.txt":            "aaaaaaaa",
+		"docs/b.txt":            "bbbbbbbb",
+		"docs/c.txt":            "cccc",
+		"docs-old/a.txt":        "aaaaaaaa",
+		"docs-old/b.txt":        "bbbbbbbb",
+		"docs-old/d.txt":        "dddd",
+		"unrelated/single.txt":  "only here",
+		"unrelated/another.txt": "xxxx",
+	})
+	duplicates, _, _, allFiles, err := FindDuplicates([]string{dir}, set.NewSet[string](), ScanOptions{}, 2, nil, 0)
+	assert.Nil(t, err)
+	rel := func(overlaps []entity.DirectoryOverlap) []entity.DirectoryOverlap {
+		for i := range overlaps {
+			overlaps[i].Dir, _ = filepath.Rel(dir, overlaps[i].Dir)
+			overlaps[i].OtherDir, _ = filepath.Rel(dir, overlaps[i].OtherDir)
+		}
+		return overlaps
+	}
+	assert.Equal(t, []entity.DirectoryOverlap{
+		{Dir: "backup", OtherDir: "photos", SharedSize: 8, OtherUniqueSize: 4, IsSubset: true},
+		{Dir: "photos/trip", OtherDir: "backup/2019", SharedSize: 4, OtherUniqueSize: 4, IsSubset: true},
+		{Dir: "docs", OtherDir: "docs-old", SharedSize: 16, UniqueSize: 4, OtherUniqueSize: 4},
+	}, rel(FindOverlappingDirectories(duplicates, allFiles, []string{dir}, 50)))
+	assert.Equal(t, []entity.DirectoryOverlap{
+		{Dir: "backup", OtherDir: "photos", SharedSize: 8, OtherUniqueSize: 4, IsSubset: true},
+		{Dir: "photos/trip", OtherDir: "backup/2019", SharedSize: 4, OtherUniqueSize: 4, IsSubset: true},
+	}, rel(FindOverlappingDirectories(duplicates, allFiles, []string{dir}, 80)))
+}
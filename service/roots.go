@@ -0,0 +1,55 @@
+package service
+
+import (
+	"github.com/m-manu/go-find-duplicates/entity"
+)
+
+// FilterByRootCount keeps only the groups of duplicates that have files from at least minRoots distinct input
+// directories (roots)
+func FilterByRootCount(duplicates *entity.DigestToFiles, allFiles entity.FilePathToMeta, minRoots int) (
+	filtered *entity.DigestToFiles, duplicateTotalCount int64, savingsSize int64,
+) {
+	filtered = entity.NewDigestToFiles()
+	for iter := duplicates.Iterator(); iter.HasNext(); {
+		digest, paths := iter.Next()
+		roots := make(map[int]struct{}, len(paths))
+		for _, path := range paths {
+			roots[allFiles[path].Root] = struct{}{}
+		}
+		if len(roots) < minRoots {
+			continue
+		}
+		for _, path := range paths {
+			filtered.Set(*digest, path)
+		}
+	}
+	duplicateTotalCount, savingsSize = countDuplicates(filtered, allFiles)
+	return filtered, duplicateTotalCount, savingsSize
+}
+
+// SharedSizesOfRoots computes, for every pair of input directories (roots), the total size of contents found in both.
+// Element [i][j] of the returned matrix is for roots i and j (numbered as in FileMeta.Root), while [i][i] is the total
+// size of contents in root i that have duplicates.
+func SharedSizesOfRoots(duplicates *entity.DigestToFiles, allFiles entity.FilePathToMeta, numRoots int) [][]int64 {
+	sharedSizes := make([][]int64, numRoots)
+	for i := range sharedSizes {
+		sharedSizes[i] = make([]int64, numRoots)
+	}
+	for iter := duplicates.Iterator(); iter.HasNext(); {
+		digest, paths := iter.Next()
+		inRoot := make([]bool, numRoots)
+		for _, path := range paths {
+			if root := allFiles[path].Root; root < numRoots {
+				inRoot[root] = true
+			}
+		}
+		for i := range inRoot {
+			for j := range inRoot {
+				if inRoot[i] && inRoot[j] {
+					sharedSizes[i][j] += digest.FileSize
+				}
+			}
+		}
+	}
+	return sharedSizes
+}
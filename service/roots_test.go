@@ -0,0 +1,45 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoots(t *testing.T) {
+	fmte.Off()
+	dir := t.TempDir()
+	createFiles(t, dir, map[string]string{
+		"laptop/a.txt":      "everywhere",
+		"nas/a.txt":         "everywhere",
+		"usb/a.txt":         "everywhere",
+		"laptop/b.txt":      "laptop and nas",
+		"nas/b.txt":         "laptop and nas",
+		"usb/c.txt":         "only usb",
+		"usb/copy/c.txt":    "only usb",
+		"laptop/d.txt":      "laptop, twice",
+		"laptop/copy/d.txt": "laptop, twice",
+	})
+	roots := []string{filepath.Join(dir, "laptop"), filepath.Join(dir, "nas"), filepath.Join(dir, "usb")}
+	duplicates, _, _, allFiles, err := FindDuplicates(roots, set.NewSet[string](), ScanOptions{}, 2,
+		nil, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, duplicates.Size())
+	for minRoots, expectedGroups := range map[int]int{0: 4, 1: 4, 2: 2, 3: 1, 4: 0} {
+		filtered, count, _ := FilterByRootCount(duplicates, allFiles, minRoots)
+		assert.Equal(t, expectedGroups, filtered.Size(), minRoots)
+		if minRoots == 3 {
+			assert.Equal(t, int64(2), count)
+		}
+	}
+	a, b, c, d := int64(len("everywhere")), int64(len("laptop and nas")), int64(len("only usb")),
+		int64(len("laptop, twice"))
+	assert.Equal(t, [][]int64{
+		{a + b + d, a + b, a},
+		{a + b, a + b, a},
+		{a, a, a + c},
+	}, SharedSizesOfRoots(duplicates, allFiles, len(roots)))
+}
@@ -0,0 +1,19 @@
+//go:build !unix
+
+package utils
+
+import (
+	"os"
+)
+
+// GetFileID gets device and inode numbers of the file whose metadata is provided
+// (not supported on this platform)
+func GetFileID(_ os.FileInfo) (device uint64, inode uint64, ok bool) {
+	return 0, 0, false
+}
+
+// GetNumLinks gets the number of hard links to the file whose metadata is provided
+// (not supported on this platform)
+func GetNumLinks(_ os.FileInfo) (numLinks uint64, ok bool) {
+	return 0, false
+}
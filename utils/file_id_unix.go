@@ -0,0 +1,26 @@
+//go:build unix
+
+package utils
+
+import (
+	"os"
+	"syscall"
+)
+
+// GetFileID gets device and inode numbers of the file whose metadata is provided
+func GetFileID(info os.FileInfo) (device uint64, inode uint64, ok bool) {
+	stat, isStat := info.Sys().(*syscall.Stat_t)
+	if !isStat {
+		return 0, 0, false
+	}
+	return uint64(stat.Dev), uint64(stat.Ino), true
+}
+
+// GetNumLinks gets the number of hard links to the file whose metadata is provided
+func GetNumLinks(info os.FileInfo) (numLinks uint64, ok bool) {
+	stat, isStat := info.Sys().(*syscall.Stat_t)
+	if !isStat {
+		return 0, false
+	}
+	return uint64(stat.Nlink), true
+}
@@ -16,6 +16,29 @@ func IsReadableDirectory(path string) bool {
 	return fileInfo.IsDir()
 }
 
+// IsUnder checks whether the path is the directory itself or is somewhere under it
+func IsUnder(path string, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// ResolvePath gets the absolute path, with symbolic links resolved. Since the path may not exist (yet), links are
+// resolved in the longest part of it that exists.
+func ResolvePath(path string) string {
+	abs, _ := filepath.Abs(path)
+	existing, rest := abs, ""
+	for {
+		if resolved, err := filepath.EvalSymlinks(existing); err == nil {
+			return filepath.Join(resolved, rest)
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return abs
+		}
+		existing, rest = parent, filepath.Join(filepath.Base(existing), rest)
+	}
+}
+
 // IsReadableFile checks whether argument is a readable file
 func IsReadableFile(path string) bool {
 	fileInfo, statErr := os.Stat(path)